@@ -31,12 +31,7 @@ func EnableAutoStart() error {
 		return err
 	}
 
-	// // To get other useful data
-	// app.DataDir()
-	// app.StdOutPath()
-	// app.StdErrPath()
-
-	// TODO: handle logging?
+	// the autostarted service logs to DefaultLogPath, see the autostart flag
 
 	return nil
 }
@@ -0,0 +1,771 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+type command struct {
+	name        string
+	usage       string
+	description string
+	run         func(ctx context.Context, args []string, w io.Writer) error
+}
+
+// commands returns the subcommands, without a command the service runs like with "run"
+func commands() []command {
+	return []command{
+		{"run", "[flags]", "watches the dropbox folders and sets the ignore flags (default without command)", func(ctx context.Context, args []string, w io.Writer) error {
+			return runService(ctx, args)
+		}},
+		{"scan", "[flags]", "walks the dropbox folders once and prints the paths, that would get ignored, without changing any flag", scanCommand},
+		{"plan", "[flags]", "writes the paths, that would gain or lose the ignore flag, as json plan", planCommand},
+		{"apply", "[flags]", "walks the dropbox folders once and sets the ignore flags, with -plan it applies a plan", applyCommand},
+		{"status", "[flags]", "prints the ignore files, ignored paths and the flags, that differ from the ignore rules (of the running service, if there is one)", statusCommand},
+		{"list-ignored", "[flags]", "prints the paths, that the ignore rules ignore", listIgnoredCommand},
+		{"list-flagged", "[flags]", "prints every path with the ignore flag", listFlaggedCommand},
+		{"explain", "[flags] <path>...", "prints the ignore rule, that ignores a path", explainCommand},
+		{"unignore", "[flags] <path|glob>...", "removes the ignore flag of the paths, a glob may contain ** (quote it)", unignoreCommand},
+		{"pause", "[flags]", "pauses the running service, no flag gets changed until resume", rootsControlCommand("pause", "paused", (*ControlClient).Pause)},
+		{"resume", "[flags]", "resumes the running service", rootsControlCommand("resume", "resumed", (*ControlClient).Resume)},
+		{"rescan", "[flags]", "lets the running service walk the dropbox folders again", rootsControlCommand("rescan", "rescanning", (*ControlClient).Rescan)},
+		{"reload", "[flags]", "lets the running service read the dropbox config file again", rootsControlCommand("reload", "handling", (*ControlClient).Reload)},
+		{"help", "", "prints the commands", func(ctx context.Context, args []string, w io.Writer) error {
+			return printCommands(w)
+		}},
+	}
+}
+
+func printCommands(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "usage: %s [command] [flags]\n\ncommands:\n", filepath.Base(os.Args[0]))
+	if err != nil {
+		return err
+	}
+	for _, c := range commands() {
+		_, err = fmt.Fprintf(w, "  %s\n      %s\n", strings.TrimSpace(c.name+" "+c.usage), c.description)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "\nrun <command> -h for the flags of a command\n")
+	return err
+}
+
+// RunCommand runs the command of args[0] and writes its output to w, the service if args starts with a flag
+func RunCommand(args []string, w io.Writer) error {
+	// TODO: fyne package seems hide signals from us, the nogui build gets them
+	ctx, ctxStop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer ctxStop()
+
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return runService(ctx, args)
+	}
+	for _, c := range commands() {
+		if c.name == args[0] {
+			err := c.run(ctx, args[1:], w)
+			if errors.Is(err, flag.ErrHelp) {
+				return nil
+			}
+			return err
+		}
+	}
+	_ = printCommands(os.Stderr)
+	return withExitCode(ExitUsage, fmt.Errorf("unknown command %q", args[0]))
+}
+
+// isServiceCommand reports, if args run the service, the other commands never show a window
+func isServiceCommand(args []string) bool {
+	return len(args) == 0 || strings.HasPrefix(args[0], "-") || args[0] == "run"
+}
+
+// commandOptions are the flags every command except run has
+type commandOptions struct {
+	dropboxFolders stringArrayFlags
+	accountType    string
+	json           bool
+	verbose        bool
+	socket         string
+	w              io.Writer
+}
+
+// parseCommandFlags parses the common flags and the flags of addFlags, that may be nil
+func parseCommandFlags(name string, args []string, w io.Writer, addFlags func(flags *flag.FlagSet)) (*commandOptions, []string, error) {
+	o := &commandOptions{w: w}
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	if addFlags != nil {
+		addFlags(flags)
+	}
+	flags.Var(&o.dropboxFolders, "f", "the path to the dropbox root folder, may be specified multiple times (skips reading dropbox config file)")
+	flags.StringVar(&o.accountType, "account", "", "Only use the dropbox folder of this account: personal or business (default: all accounts of the dropbox config file)")
+	flags.BoolVar(&o.json, "json", false, "Prints the result as json")
+	flags.BoolVar(&o.verbose, "v", false, "Logs the details to stderr")
+	flags.StringVar(&o.socket, "socket", ControlSocketPath(), "The control socket of the running service, without a running service the dropbox folders are scanned (empty: always scan)")
+	err := flags.Parse(args)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, nil, err
+		}
+		return nil, nil, withExitCode(ExitUsage, err)
+	}
+
+	_, err = FilterDropboxAccounts(nil, o.accountType)
+	if err != nil {
+		return nil, nil, withExitCode(ExitUsage, err)
+	}
+	if o.accountType != "" && len(o.dropboxFolders) > 0 {
+		return nil, nil, withExitCode(ExitUsage, fmt.Errorf("-account can not be combined with -f"))
+	}
+	return o, flags.Args(), nil
+}
+
+// roots returns the absolute paths of the selected dropbox folders
+func (o *commandOptions) roots() ([]string, error) {
+	roots, err := getDropboxFoldersEnsured(o.dropboxFolders, o.accountType)
+	if err != nil {
+		return nil, err
+	}
+	absRoots := make([]string, len(roots))
+	for i, root := range roots {
+		absRoots[i], err = filepath.Abs(root)
+		if err != nil {
+			return nil, fmt.Errorf("error getting abs path of %s: %w", root, err)
+		}
+	}
+	return absRoots, nil
+}
+
+func (o *commandOptions) logger() *slog.Logger {
+	w := io.Discard
+	if o.verbose {
+		w = os.Stderr
+	}
+	return NewLogger(w, NewLogOptions(LogFormatText, LogLevels{Default: slog.LevelInfo}), nil)
+}
+
+// print writes v as json with -json, otherwise calls text
+func (o *commandOptions) print(v any, text func(w io.Writer) error) error {
+	if o.json {
+		encoder := json.NewEncoder(o.w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(v)
+	}
+	return text(o.w)
+}
+
+// control connects to the running service, nil if none is running
+func (o *commandOptions) control() *ControlClient {
+	if o.socket == "" {
+		return nil
+	}
+	client, err := DialControl(o.socket)
+	if err != nil {
+		componentLogger(o.logger(), LogComponentControl).Info("no running service, scanning the dropbox folders", "socket", o.socket, LogKeyError, err)
+		return nil
+	}
+	return client
+}
+
+// requireControl connects to the running service, for the commands only the running service can handle
+func (o *commandOptions) requireControl() (*ControlClient, error) {
+	if o.socket == "" {
+		return nil, withExitCode(ExitUsage, fmt.Errorf("the command needs the control socket of the running service"))
+	}
+	client, err := DialControl(o.socket)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to the running service: %w", err)
+	}
+	return client, nil
+}
+
+// controlArgs selects the dropbox folders of -f or -account, without them all of the running service
+func (o *commandOptions) controlArgs(paths []string) (ControlArgs, error) {
+	args := ControlArgs{Paths: paths}
+	if len(o.dropboxFolders) > 0 || o.accountType != "" {
+		roots, err := o.roots()
+		if err != nil {
+			return ControlArgs{}, err
+		}
+		args.Roots = roots
+	}
+	return args, nil
+}
+
+// scanRoots walks every root once without a file watcher
+func (o *commandOptions) scanRoots(ctx context.Context, tryRun bool) ([]*DropboxIgnorer, error) {
+	roots, err := o.roots()
+	if err != nil {
+		return nil, err
+	}
+	ignorers := make([]*DropboxIgnorer, 0, len(roots))
+	for _, root := range roots {
+		ignorer, err := ScanDropbox(root, tryRun, o.logger(), ctx, NewEventBus())
+		if err != nil {
+			return nil, err
+		}
+		ignorers = append(ignorers, ignorer)
+	}
+	return ignorers, nil
+}
+
+// IgnoredPath is a path, that the ignore rules ignore
+type IgnoredPath struct {
+	Root string `json:"root"`
+	Path string `json:"path"`
+	// IgnoreFile and Rule are the ignore file and its pattern, that ignore Path
+	IgnoreFile string `json:"ignoreFile"`
+	Rule       string `json:"rule"`
+	Flagged    bool   `json:"flagged"`
+	// AlreadyUploaded is true, if dropbox synced Path before it got flagged
+	AlreadyUploaded bool `json:"alreadyUploaded"`
+}
+
+func ignoredPaths(i *DropboxIgnorer) []IgnoredPath {
+	paths := []IgnoredPath{}
+	for _, path := range i.IgnoredPathsSet().Values() {
+		ignoreFile, rule, _ := i.matchingIgnoreRule(path)
+		flagged, err := HasDropboxIgnoreFlag(path)
+		if err != nil {
+			i.logger.Error("checking ignore flag failed", LogKeyPath, path, LogKeyError, err)
+		}
+		paths = append(paths, IgnoredPath{
+			Root:            i.DropboxPath(),
+			Path:            path,
+			IgnoreFile:      ignoreFile,
+			Rule:            rule,
+			Flagged:         flagged,
+			AlreadyUploaded: i.AlreadyUploadedSet().Has(path),
+		})
+	}
+	return paths
+}
+
+func printIgnoredPaths(w io.Writer, paths []IgnoredPath) error {
+	for _, p := range paths {
+		uploaded := ""
+		if p.AlreadyUploaded {
+			uploaded = ", already uploaded"
+		}
+		_, err := fmt.Fprintf(w, "%s (%s: %s%s)\n", p.Path, p.IgnoreFile, p.Rule, uploaded)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func scanCommand(ctx context.Context, args []string, w io.Writer) error {
+	o, _, err := parseCommandFlags("scan", args, w, nil)
+	if err != nil {
+		return err
+	}
+	return o.printScan(ctx, true)
+}
+
+func applyCommand(ctx context.Context, args []string, w io.Writer) error {
+	var planFile string
+	o, _, err := parseCommandFlags("apply", args, w, func(flags *flag.FlagSet) {
+		flags.StringVar(&planFile, "plan", "", "Applies exactly the plan file of the plan command, refuses if the dropbox folders changed since (the plan selects the dropbox folders)")
+	})
+	if err != nil {
+		return err
+	}
+	if planFile == "" {
+		return o.printScan(ctx, false)
+	}
+	if len(o.dropboxFolders) > 0 || o.accountType != "" {
+		return withExitCode(ExitUsage, fmt.Errorf("-plan can not be combined with -f or -account"))
+	}
+
+	data, err := os.ReadFile(planFile)
+	if err != nil {
+		return fmt.Errorf("error reading plan: %w", err)
+	}
+	var plan Plan
+	err = json.Unmarshal(data, &plan)
+	if err != nil {
+		return fmt.Errorf("error parsing plan %s: %w", planFile, err)
+	}
+	err = ApplyPlan(ctx, plan, o.logger())
+	if err != nil {
+		return err
+	}
+
+	changes := []PlanChange{}
+	for _, rootPlan := range plan.Roots {
+		changes = append(changes, rootPlan.Changes...)
+	}
+	return o.print(changes, func(w io.Writer) error {
+		for _, c := range changes {
+			_, err := fmt.Fprintf(w, "%sd %s (%s)\n", c.Action, c.Path, formatSize(c.Size))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// printScan walks every root once and prints the ignored paths, the flags are only set without tryRun
+func (o *commandOptions) printScan(ctx context.Context, tryRun bool) error {
+	ignorers, err := o.scanRoots(ctx, tryRun)
+	if err != nil {
+		return err
+	}
+	paths := []IgnoredPath{}
+	for _, i := range ignorers {
+		paths = append(paths, ignoredPaths(i)...)
+	}
+	return o.print(paths, func(w io.Writer) error {
+		return printIgnoredPaths(w, paths)
+	})
+}
+
+func planCommand(ctx context.Context, args []string, w io.Writer) error {
+	var planFile string
+	o, _, err := parseCommandFlags("plan", args, w, func(flags *flag.FlagSet) {
+		flags.StringVar(&planFile, "o", "", "The file the plan is written to, a summary is printed instead (default: print the plan)")
+	})
+	if err != nil {
+		return err
+	}
+	roots, err := o.roots()
+	if err != nil {
+		return err
+	}
+	plan, err := MakePlan(ctx, roots, o.logger())
+	if err != nil {
+		return err
+	}
+	if planFile == "" {
+		o.json = true
+		return o.print(plan, nil)
+	}
+
+	data, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(planFile, append(data, '\n'), 0o644)
+	if err != nil {
+		return fmt.Errorf("error writing plan: %w", err)
+	}
+	return o.print(plan, func(w io.Writer) error {
+		for _, rootPlan := range plan.Roots {
+			ignoreCount, ignoreSize := rootPlan.Summary(PlanActionIgnore)
+			unignoreCount, unignoreSize := rootPlan.Summary(PlanActionUnignore)
+			_, err := fmt.Fprintf(w, "%s: %d paths to ignore (%s), %d paths to unignore (%s)\n", rootPlan.Root, ignoreCount, formatSize(ignoreSize), unignoreCount, formatSize(unignoreSize))
+			if err != nil {
+				return err
+			}
+		}
+		_, err := fmt.Fprintf(w, "review %s and apply it with: apply -plan %s\n", planFile, planFile)
+		return err
+	})
+}
+
+func listIgnoredCommand(ctx context.Context, args []string, w io.Writer) error {
+	o, _, err := parseCommandFlags("list-ignored", args, w, nil)
+	if err != nil {
+		return err
+	}
+	paths := []string{}
+	if client := o.control(); client != nil {
+		defer client.Close()
+		controlArgs, err := o.controlArgs(nil)
+		if err != nil {
+			return err
+		}
+		paths, err = client.ListIgnored(controlArgs)
+		if err != nil {
+			return err
+		}
+	} else {
+		ignorers, err := o.scanRoots(ctx, true)
+		if err != nil {
+			return err
+		}
+		for _, i := range ignorers {
+			paths = append(paths, i.IgnoredPathsSet().Values()...)
+		}
+	}
+	return o.print(paths, func(w io.Writer) error {
+		for _, path := range paths {
+			_, err := fmt.Fprintln(w, path)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// RootStatus is the state of a dropbox folder printed by the status command
+type RootStatus struct {
+	Root string `json:"root"`
+	// Running is true for the status of the running service, only then Paused and Watcher are set
+	Running bool   `json:"running"`
+	Paused  bool   `json:"paused"`
+	Watcher string `json:"watcher,omitempty"`
+
+	IgnoreFiles     []string `json:"ignoreFiles"`
+	IgnoredPaths    int      `json:"ignoredPaths"`
+	AlreadyUploaded int      `json:"alreadyUploaded"`
+
+	// Reconciled is the end of the drift report, zero if the running service made none yet
+	Reconciled      time.Time `json:"reconciled"`
+	MissingFlags    []string  `json:"missingFlags"`
+	UnexpectedFlags []string  `json:"unexpectedFlags"`
+	NestedFlags     []string  `json:"nestedFlags"`
+}
+
+// rootStatus returns the status of i, report may be nil
+func rootStatus(i *DropboxIgnorer, report *DriftReport, running bool) RootStatus {
+	s := RootStatus{
+		Root:            i.DropboxPath(),
+		Running:         running,
+		IgnoreFiles:     i.IgnoreFiles().Values(),
+		IgnoredPaths:    i.IgnoredPathsSet().Len(),
+		AlreadyUploaded: i.AlreadyUploadedSet().Len(),
+		MissingFlags:    []string{},
+		UnexpectedFlags: []string{},
+		NestedFlags:     []string{},
+	}
+	if running {
+		s.Paused = i.Paused()
+		s.Watcher = i.WatcherState().String()
+	}
+	if report != nil {
+		s.Reconciled = report.Finished
+		s.MissingFlags = append(s.MissingFlags, report.MissingFlags...)
+		s.UnexpectedFlags = append(s.UnexpectedFlags, report.UnexpectedFlags...)
+		s.NestedFlags = append(s.NestedFlags, report.NestedFlags...)
+	}
+	return s
+}
+
+func statusCommand(ctx context.Context, args []string, w io.Writer) error {
+	o, _, err := parseCommandFlags("status", args, w, nil)
+	if err != nil {
+		return err
+	}
+	var statuses []RootStatus
+	if client := o.control(); client != nil {
+		defer client.Close()
+		controlArgs, err := o.controlArgs(nil)
+		if err != nil {
+			return err
+		}
+		statuses, err = client.Status(controlArgs)
+		if err != nil {
+			return err
+		}
+	} else {
+		ignorers, err := o.scanRoots(ctx, true)
+		if err != nil {
+			return err
+		}
+		for _, i := range ignorers {
+			// no event loop runs, the walk may use the ignore rules of the ignorer
+			report := i.reconcile(i)
+			if report.Err != nil {
+				return report.Err
+			}
+			statuses = append(statuses, rootStatus(i, &report, false))
+		}
+	}
+	return o.print(statuses, func(w io.Writer) error {
+		for _, s := range statuses {
+			_, err := fmt.Fprintf(w, "%s\n  ignore files: %d\n  ignored paths: %d (%d already uploaded)\n", s.Root, len(s.IgnoreFiles), s.IgnoredPaths, s.AlreadyUploaded)
+			if err != nil {
+				return err
+			}
+			if s.Running {
+				state := "running"
+				if s.Paused {
+					state = "paused"
+				}
+				reconciled := "never"
+				if !s.Reconciled.IsZero() {
+					reconciled = s.Reconciled.Format(time.DateTime)
+				}
+				_, err = fmt.Fprintf(w, "  service: %s, file watcher: %s, last reconcile: %s\n", state, s.Watcher, reconciled)
+				if err != nil {
+					return err
+				}
+			}
+			for _, group := range []struct {
+				name  string
+				paths []string
+			}{
+				{"missing flag", s.MissingFlags},
+				{"unexpected flag", s.UnexpectedFlags},
+				{"flag inside flagged directory", s.NestedFlags},
+			} {
+				for _, path := range group.paths {
+					_, err = fmt.Fprintf(w, "  %s: %s\n", group.name, path)
+					if err != nil {
+						return err
+					}
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func listFlaggedCommand(ctx context.Context, args []string, w io.Writer) error {
+	o, _, err := parseCommandFlags("list-flagged", args, w, nil)
+	if err != nil {
+		return err
+	}
+	roots, err := o.roots()
+	if err != nil {
+		return err
+	}
+
+	paths := []ScannedPath{}
+	var writeErr error
+	err = ScanFlaggedPaths(ctx, roots, FlaggedScanOptions{
+		OnPath: func(p ScannedPath) {
+			if o.json {
+				paths = append(paths, p)
+			} else if writeErr == nil {
+				// printed while scanning, big dropbox folders take a while
+				_, writeErr = fmt.Fprintln(w, p.Path)
+			}
+		},
+	})
+	if err != nil || writeErr != nil || !o.json {
+		return errors.Join(err, writeErr)
+	}
+	return o.print(paths, nil)
+}
+
+// UnignoredPath is a path of the unignore command
+type UnignoredPath struct {
+	Path string `json:"path"`
+	// Unignored is false, if Path had no ignore flag
+	Unignored bool `json:"unignored"`
+}
+
+func unignoreCommand(ctx context.Context, args []string, w io.Writer) error {
+	o, patterns, err := parseCommandFlags("unignore", args, w, nil)
+	if err != nil {
+		return err
+	}
+	if len(patterns) == 0 {
+		return withExitCode(ExitUsage, fmt.Errorf("unignore needs at least one path or glob"))
+	}
+	patterns, err = absPaths(patterns)
+	if err != nil {
+		return err
+	}
+
+	var results []UnignoredPath
+	if client := o.control(); client != nil {
+		defer client.Close()
+		controlArgs, err := o.controlArgs(patterns)
+		if err != nil {
+			return err
+		}
+		results, err = client.Unignore(controlArgs)
+		if err != nil {
+			return err
+		}
+	} else {
+		roots, err := o.roots()
+		if err != nil {
+			return err
+		}
+		results, err = unignorePaths(roots, patterns)
+		if err != nil {
+			return err
+		}
+	}
+	return o.print(results, func(w io.Writer) error {
+		for _, r := range results {
+			state := "unignored"
+			if !r.Unignored {
+				state = "had no ignore flag"
+			}
+			_, err := fmt.Fprintf(w, "%s: %s\n", r.Path, state)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// unignorePaths removes the ignore flag of the paths matching the absolute patterns, all of them must be inside roots.
+// It is used without a running service, the service unignores through its dropbox ignorers.
+func unignorePaths(roots []string, patterns []string) ([]UnignoredPath, error) {
+	paths, err := globUnignorePaths(roots, patterns)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []UnignoredPath{}
+	for _, path := range paths {
+		hasFlag, err := HasDropboxIgnoreFlag(path)
+		if err != nil {
+			return nil, fmt.Errorf("error checking ignore flag of %s: %w", path, err)
+		}
+		if hasFlag {
+			err = RemoveDropboxIgnoreFlag(path)
+			if err != nil {
+				return nil, fmt.Errorf("error removing ignore flag of %s: %w", path, err)
+			}
+		}
+		results = append(results, UnignoredPath{Path: path, Unignored: hasFlag})
+	}
+	return results, nil
+}
+
+// globUnignorePaths returns the paths matching the absolute patterns, all of them must be inside roots
+func globUnignorePaths(roots []string, patterns []string) ([]string, error) {
+	paths := []string{}
+	for _, pattern := range patterns {
+		matches, err := doublestar.FilepathGlob(pattern, doublestar.WithNoFollow())
+		if err != nil {
+			return nil, withExitCode(ExitUsage, fmt.Errorf("invalid glob %s: %w", pattern, err))
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no path matches %s", pattern)
+		}
+		for _, path := range matches {
+			if !isInsideRoots(roots, path) {
+				return nil, fmt.Errorf("%s is not inside a dropbox folder %v", path, roots)
+			}
+		}
+		paths = append(paths, matches...)
+	}
+	return paths, nil
+}
+
+func explainCommand(ctx context.Context, args []string, w io.Writer) error {
+	o, paths, err := parseCommandFlags("explain", args, w, nil)
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return withExitCode(ExitUsage, fmt.Errorf("explain needs at least one path"))
+	}
+	paths, err = absPaths(paths)
+	if err != nil {
+		return err
+	}
+
+	explanations := []PathExplanation{}
+	if client := o.control(); client != nil {
+		defer client.Close()
+		controlArgs, err := o.controlArgs(paths)
+		if err != nil {
+			return err
+		}
+		explanations, err = client.Explain(controlArgs)
+		if err != nil {
+			return err
+		}
+	} else {
+		ignorers, err := o.scanRoots(ctx, true)
+		if err != nil {
+			return err
+		}
+		for _, path := range paths {
+			i := ignorerOf(ignorers, path)
+			if i == nil {
+				return fmt.Errorf("%s is not inside a dropbox folder", path)
+			}
+			explanations = append(explanations, i.explain(path))
+		}
+	}
+	return o.print(explanations, func(w io.Writer) error {
+		for _, e := range explanations {
+			reason := "not ignored"
+			if e.IgnoredParent != "" {
+				reason = fmt.Sprintf("ignored, inside %s ignored by %s: %s", e.IgnoredParent, e.IgnoreFile, e.Rule)
+			} else if e.Ignored {
+				reason = fmt.Sprintf("ignored by %s: %s", e.IgnoreFile, e.Rule)
+			}
+			flagState := "no ignore flag"
+			if e.Flagged {
+				flagState = "has ignore flag"
+			}
+			if e.AlreadyUploaded {
+				flagState += ", already uploaded"
+			}
+			_, err := fmt.Fprintf(w, "%s: %s (%s)\n", e.Path, reason, flagState)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// rootsControlCommand returns a command, that calls the running service for the selected dropbox folders
+func rootsControlCommand(name string, done string, call func(c *ControlClient, args ControlArgs) ([]string, error)) func(ctx context.Context, args []string, w io.Writer) error {
+	return func(ctx context.Context, args []string, w io.Writer) error {
+		o, _, err := parseCommandFlags(name, args, w, nil)
+		if err != nil {
+			return err
+		}
+		client, err := o.requireControl()
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+		controlArgs, err := o.controlArgs(nil)
+		if err != nil {
+			return err
+		}
+		roots, err := call(client, controlArgs)
+		if err != nil {
+			return err
+		}
+		return o.print(roots, func(w io.Writer) error {
+			for _, root := range roots {
+				_, err := fmt.Fprintf(w, "%s %s\n", done, root)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+}
+
+func absPaths(paths []string) ([]string, error) {
+	absPaths := make([]string, len(paths))
+	for n, path := range paths {
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return nil, fmt.Errorf("error getting abs path of %s: %w", path, err)
+		}
+		absPaths[n] = absPath
+	}
+	return absPaths, nil
+}
+
+func isInsideRoots(roots []string, path string) bool {
+	for _, root := range roots {
+		if path == root || strings.HasPrefix(path, root+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package main_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	main "github.com/anton15x/dropbox_ignore_service"
+	"github.com/stretchr/testify/require"
+)
+
+func runCommandJSON[T any](t *testing.T, args ...string) T {
+	var out bytes.Buffer
+	// flags must be in front of the paths of unignore, no running service is used
+	requireNoError(t, main.RunCommand(append([]string{args[0], "-json", "-socket="}, args[1:]...), &out))
+	var v T
+	requireNoError(t, json.Unmarshal(out.Bytes(), &v))
+	return v
+}
+
+func TestCommands(t *testing.T) {
+	CheckTestParallel(t)
+
+	root := t.TempDir()
+	ignoredDir := filepath.Join(root, "a", "node_modules")
+	ignoredFile := filepath.Join(root, "b", "x.log")
+	requireNoError(t, os.MkdirAll(ignoredDir, os.ModePerm))
+	requireMkdir(t, filepath.Dir(ignoredFile))
+	requireNoError(t, os.WriteFile(ignoredFile, nil, os.ModePerm))
+	createDropboxignore(t, filepath.Join(root, main.DropboxIgnoreFilename), "node_modules", "*.log")
+
+	// scan changes no flag
+	scanned := runCommandJSON[[]main.IgnoredPath](t, "scan", "-f", root)
+	require.Len(t, scanned, 2)
+	require.Equal(t, ignoredDir, scanned[0].Path)
+	require.Equal(t, filepath.Join(root, main.DropboxIgnoreFilename), scanned[0].IgnoreFile)
+	require.False(t, scanned[0].Flagged)
+	require.Equal(t, []string{ignoredDir, ignoredFile}, runCommandJSON[[]string](t, "list-ignored", "-f", root))
+
+	status := runCommandJSON[[]main.RootStatus](t, "status", "-f", root)
+	require.Len(t, status, 1)
+	require.Equal(t, 2, status[0].IgnoredPaths)
+	require.Equal(t, []string{ignoredDir, ignoredFile}, status[0].MissingFlags)
+
+	applied := runCommandJSON[[]main.IgnoredPath](t, "apply", "-f", root)
+	require.Len(t, applied, 2)
+	require.True(t, applied[0].Flagged)
+	require.True(t, applied[1].Flagged)
+	status = runCommandJSON[[]main.RootStatus](t, "status", "-f", root)
+	require.Empty(t, status[0].MissingFlags)
+	require.Len(t, runCommandJSON[[]main.ScannedPath](t, "list-flagged", "-f", root), 2)
+
+	unignored := runCommandJSON[[]main.UnignoredPath](t, "unignore", "-f", root, filepath.Join(root, "**", "*.log"))
+	require.Equal(t, []main.UnignoredPath{{Path: ignoredFile, Unignored: true}}, unignored)
+	hasFlag, err := main.HasDropboxIgnoreFlag(ignoredFile)
+	requireNoError(t, err)
+	require.False(t, hasFlag)
+
+	// paths outside of the dropbox folders are never changed
+	err = main.RunCommand([]string{"unignore", "-f", filepath.Join(root, "a"), ignoredFile}, &bytes.Buffer{})
+	require.Error(t, err)
+	err = main.RunCommand([]string{"unknown"}, &bytes.Buffer{})
+	require.Equal(t, main.ExitUsage, main.ExitCode(err))
+	err = main.RunCommand([]string{"scan", "-account", "unknown"}, &bytes.Buffer{})
+	require.Equal(t, main.ExitUsage, main.ExitCode(err))
+}
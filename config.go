@@ -0,0 +1,452 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/anton15x/dropbox_ignore_service/src/fsnotify"
+)
+
+// ConfigFileEnv overrides the location of the config file
+const ConfigFileEnv = "DROPBOX_IGNORE_SERVICE_CONFIG"
+
+// ConfigCheckInterval is the interval the config file is checked for changes
+const ConfigCheckInterval = 2 * time.Second
+
+// ConfigSchema is the json schema of the config file
+//
+//go:embed config.schema.json
+var ConfigSchema []byte
+
+// ConfigPath returns the location of the config file, empty if there is no user config dir
+func ConfigPath() string {
+	if path, found := os.LookupEnv(ConfigFileEnv); found {
+		return path
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "dropbox_ignore_service", "config.json")
+}
+
+// Duration is a time.Duration written as string, e.g. "24h"
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	err := json.Unmarshal(data, &s)
+	if err != nil {
+		return fmt.Errorf("duration must be a string like \"10s\": %w", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Config are the settings of the service, config.schema.json describes the config file
+type Config struct {
+	// Schema is ignored, it lets editors validate the config file
+	Schema string `json:"$schema,omitempty"`
+	// Roots are the dropbox folders, the dropbox config file is read if empty
+	Roots []string `json:"roots,omitempty"`
+	// Account only handles the dropbox folder of this account: personal or business
+	Account       string              `json:"account,omitempty"`
+	TryRun        bool                `json:"tryRun"`
+	Log           LogConfig           `json:"log"`
+	Notifications NotificationsConfig `json:"notifications"`
+	Matching      MatchingConfig      `json:"matching"`
+	Watcher       WatcherConfig       `json:"watcher"`
+	Reconcile     ReconcileConfig     `json:"reconcile"`
+	// Workers is the number of directories read in parallel by reconcile walks, plans and the ignored files tab (0: number of CPUs)
+	Workers int `json:"workers"`
+}
+
+type LogConfig struct {
+	// File is the log file, empty disables file logging
+	File   string `json:"file,omitempty"`
+	Format string `json:"format"`
+	// Level is the level of all components with optional overrides, e.g. "info,ignorer=debug"
+	Level string `json:"level"`
+	// MaxSize in MB rotates the log file, before it gets larger (0: no limit)
+	MaxSize int `json:"maxSize"`
+	// MaxAge rotates the log file, after it was written to for this duration (0: no limit)
+	MaxAge Duration `json:"maxAge"`
+	// MaxFiles is the number of rotated log files, that are kept (0: all)
+	MaxFiles int  `json:"maxFiles"`
+	Compress bool `json:"compress"`
+}
+
+func (c LogConfig) Rotation() LogRotation {
+	return LogRotation{
+		MaxSize:  int64(c.MaxSize) << 20,
+		MaxAge:   time.Duration(c.MaxAge),
+		MaxFiles: c.MaxFiles,
+		Compress: c.Compress,
+	}
+}
+
+type NotificationsConfig struct {
+	PathIgnored       bool `json:"pathIgnored"`
+	InvalidIgnoreFile bool `json:"invalidIgnoreFile"`
+}
+
+type MatchingConfig struct {
+	CaseInsensitive bool `json:"caseInsensitive"`
+}
+
+type WatcherConfig struct {
+	Backend      string   `json:"backend"`
+	PollInterval Duration `json:"pollInterval"`
+	// PollRoots always use the polling file watcher
+	PollRoots []string `json:"pollRoots,omitempty"`
+}
+
+type ReconcileConfig struct {
+	// Interval between two reconcile walks, 0 disables them
+	Interval Duration `json:"interval"`
+	Fix      bool     `json:"fix"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Log: LogConfig{
+			Format:   string(LogFormatText),
+			Level:    "info",
+			MaxSize:  DefaultLogMaxSize,
+			MaxAge:   Duration(DefaultLogMaxAge),
+			MaxFiles: DefaultLogMaxFiles,
+		},
+		Notifications: NotificationsConfig{
+			PathIgnored:       true,
+			InvalidIgnoreFile: true,
+		},
+		Watcher: WatcherConfig{
+			Backend:      string(fsnotify.BackendAuto),
+			PollInterval: Duration(fsnotify.DefaultPollInterval),
+		},
+		Reconcile: ReconcileConfig{
+			Interval: Duration(DefaultReconcileInterval),
+		},
+	}
+}
+
+// Validate returns all invalid settings
+func (c Config) Validate() error {
+	var errs []error
+	_, err := FilterDropboxAccounts(nil, c.Account)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("account: %w", err))
+	}
+	if c.Account != "" && len(c.Roots) > 0 {
+		errs = append(errs, fmt.Errorf("account can not be combined with roots"))
+	}
+	for _, root := range c.Roots {
+		if !filepath.IsAbs(root) {
+			errs = append(errs, fmt.Errorf("roots: %s is not an absolute path", root))
+		}
+	}
+	if c.Log.File != "" && !filepath.IsAbs(c.Log.File) {
+		errs = append(errs, fmt.Errorf("log.file: %s is not an absolute path", c.Log.File))
+	}
+	_, err = ParseLogFormat(c.Log.Format)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("log.format: %w", err))
+	}
+	_, err = ParseLogLevels(c.Log.Level)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("log.level: %w", err))
+	}
+	if c.Log.MaxSize < 0 {
+		errs = append(errs, fmt.Errorf("log.maxSize must not be negative"))
+	}
+	if c.Log.MaxAge < 0 {
+		errs = append(errs, fmt.Errorf("log.maxAge must not be negative"))
+	}
+	if c.Log.MaxFiles < 0 {
+		errs = append(errs, fmt.Errorf("log.maxFiles must not be negative"))
+	}
+	_, err = fsnotify.ParseBackend(c.Watcher.Backend)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("watcher.backend: %w", err))
+	}
+	if c.Watcher.PollInterval <= 0 {
+		errs = append(errs, fmt.Errorf("watcher.pollInterval must be positive"))
+	}
+	for _, root := range c.Watcher.PollRoots {
+		if !filepath.IsAbs(root) {
+			errs = append(errs, fmt.Errorf("watcher.pollRoots: %s is not an absolute path", root))
+		}
+	}
+	if c.Reconcile.Interval < 0 {
+		errs = append(errs, fmt.Errorf("reconcile.interval must not be negative"))
+	}
+	if c.Workers < 0 {
+		errs = append(errs, fmt.Errorf("workers must not be negative"))
+	}
+	return errors.Join(errs...)
+}
+
+// IgnorerOptions returns the ignorer options of the dropbox folder root
+func (c Config) IgnorerOptions(root string) IgnorerOptions {
+	options := IgnorerOptions{
+		TryRun: c.TryRun,
+		Watcher: fsnotify.Options{
+			// validated
+			Backend:      fsnotify.Backend(c.Watcher.Backend),
+			PollInterval: time.Duration(c.Watcher.PollInterval),
+		},
+		CaseInsensitive: c.Matching.CaseInsensitive,
+		Workers:         c.Workers,
+	}
+	if slices.Contains(c.Watcher.PollRoots, root) {
+		options.Watcher.Backend = fsnotify.BackendPolling
+	}
+	return options
+}
+
+func (c Config) clone() Config {
+	c.Roots = slices.Clone(c.Roots)
+	c.Watcher.PollRoots = slices.Clone(c.Watcher.PollRoots)
+	return c
+}
+
+// ParseConfig parses and validates a config file against ConfigSchema and Validate.
+// Missing settings keep their default and unknown settings are an error.
+func ParseConfig(data []byte) (Config, error) {
+	err := ValidateConfigSchema(data)
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid config: %w", err)
+	}
+	c := DefaultConfig()
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(&c)
+	if err != nil {
+		return Config{}, fmt.Errorf("error parsing config: %w", err)
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return Config{}, fmt.Errorf("error parsing config: unexpected data after the config object")
+	}
+	err = c.Validate()
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid config: %w", err)
+	}
+	return c, nil
+}
+
+// LoadConfig reads the config file path, the default config if it does not exist
+func LoadConfig(path string) (Config, error) {
+	if path == "" {
+		return DefaultConfig(), nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return DefaultConfig(), nil
+	}
+	if err != nil {
+		return Config{}, fmt.Errorf("error reading config file: %w", err)
+	}
+	c, err := ParseConfig(data)
+	if err != nil {
+		return Config{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
+
+// ConfigStore holds the config of the running service and reloads it, if the config file changes
+type ConfigStore struct {
+	path string
+	// overrides applies the command line flags, they take precedence over the config file
+	overrides func(c *Config)
+
+	m        sync.Mutex
+	config   Config
+	fileInfo os.FileInfo
+
+	listenersMutex sync.Mutex
+	onChange       []func(old Config, new Config)
+}
+
+// NewConfigStore loads the config file path, overrides may be nil
+func NewConfigStore(path string, overrides func(c *Config)) (*ConfigStore, error) {
+	s := &ConfigStore{
+		path:      path,
+		overrides: overrides,
+	}
+	c, info, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	s.config = c
+	s.fileInfo = info
+	return s, nil
+}
+
+func (s *ConfigStore) Path() string {
+	return s.path
+}
+
+func (s *ConfigStore) Config() Config {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.config.clone()
+}
+
+// AddChangeEventListener is called after a reload changed the config
+func (s *ConfigStore) AddChangeEventListener(f func(old Config, new Config)) {
+	s.listenersMutex.Lock()
+	defer s.listenersMutex.Unlock()
+
+	s.onChange = append(s.onChange, f)
+}
+
+func (s *ConfigStore) load() (Config, os.FileInfo, error) {
+	// stat first, a change while reading is found at the next check
+	var info os.FileInfo
+	if s.path != "" {
+		info, _ = os.Stat(s.path)
+	}
+	c, err := LoadConfig(s.path)
+	if err != nil {
+		return Config{}, info, err
+	}
+	if s.overrides != nil {
+		s.overrides(&c)
+		err = c.Validate()
+		if err != nil {
+			return Config{}, info, fmt.Errorf("invalid config with command line flags: %w", err)
+		}
+	}
+	return c, info, nil
+}
+
+// Reload reads the config file again, an invalid config file keeps the current config
+func (s *ConfigStore) Reload() error {
+	s.m.Lock()
+	c, info, err := s.load()
+	// an invalid file is reported once, not at every check
+	s.fileInfo = info
+	if err != nil {
+		s.m.Unlock()
+		return err
+	}
+	old := s.config
+	changed := !reflect.DeepEqual(old, c)
+	s.config = c
+	s.m.Unlock()
+
+	if changed {
+		s.listenersMutex.Lock()
+		listeners := slices.Clone(s.onChange)
+		s.listenersMutex.Unlock()
+		for _, f := range listeners {
+			f(old.clone(), c.clone())
+		}
+	}
+	return nil
+}
+
+// ReadFile returns the content of the config file, the default config if it does not exist
+func (s *ConfigStore) ReadFile() ([]byte, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return json.MarshalIndent(DefaultConfig(), "", "  ")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file: %w", err)
+	}
+	return data, nil
+}
+
+// Save validates data, writes it to the config file and reloads it
+func (s *ConfigStore) Save(data []byte) error {
+	if s.path == "" {
+		return fmt.Errorf("there is no config file location")
+	}
+	_, err := ParseConfig(data)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(s.path), 0o700)
+	if err != nil {
+		return fmt.Errorf("error creating dir of config file: %w", err)
+	}
+	// a reload must never read a half written file
+	tmpPath := s.path + ".tmp"
+	err = os.WriteFile(tmpPath, data, 0o600)
+	if err != nil {
+		return fmt.Errorf("error writing config file: %w", err)
+	}
+	err = os.Rename(tmpPath, s.path)
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("error writing config file: %w", err)
+	}
+	return s.Reload()
+}
+
+func (s *ConfigStore) fileChanged() bool {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return s.fileInfo != nil
+	}
+	return s.fileInfo == nil || !info.ModTime().Equal(s.fileInfo.ModTime()) || info.Size() != s.fileInfo.Size()
+}
+
+// Watch reloads the config file on SIGHUP and if it changed, checked every interval until ctx is done
+func (s *ConfigStore) Watch(ctx context.Context, wg *sync.WaitGroup, interval time.Duration, logger *slog.Logger) {
+	logger = componentLogger(logger, LogComponentConfig).With(LogKeyPath, s.path)
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer signal.Stop(hangup)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hangup:
+				logger.Info("SIGHUP received, reloading config file")
+			case <-ticker.C:
+				if s.path == "" || !s.fileChanged() {
+					continue
+				}
+				logger.Info("config file changed, reloading it")
+			}
+			err := s.Reload()
+			if err != nil {
+				logger.Error("reloading config file failed, keeping the current config", LogKeyError, err)
+			}
+		}
+	}()
+}
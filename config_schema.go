@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// configSchema is the parsed ConfigSchema
+var configSchema = sync.OnceValues(func() (map[string]any, error) {
+	var schema map[string]any
+	err := json.Unmarshal(ConfigSchema, &schema)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing config schema: %w", err)
+	}
+	return schema, nil
+})
+
+// schemaAnnotations are the keywords of the config schema, that do not validate
+var schemaAnnotations = []string{"$schema", "title", "description", "default"}
+
+// ValidateConfigSchema validates the config file data against ConfigSchema.
+// Only the keywords of draft-07 used by ConfigSchema are supported: type, enum, properties, additionalProperties, items and minimum.
+func ValidateConfigSchema(data []byte) error {
+	schema, err := configSchema()
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var document any
+	err = decoder.Decode(&document)
+	if err != nil {
+		return fmt.Errorf("error parsing config: %w", err)
+	}
+	return errors.Join(validateSchema(schema, document, "")...)
+}
+
+func validateSchema(schema map[string]any, value any, path string) []error {
+	name := path
+	if name == "" {
+		name = "config"
+	}
+	keywords := make([]string, 0, len(schema))
+	for keyword := range schema {
+		keywords = append(keywords, keyword)
+	}
+	// the errors are reported in the same order every time
+	sort.Strings(keywords)
+
+	var errs []error
+	for _, keyword := range keywords {
+		switch keyword {
+		case "type":
+			typ, _ := schema[keyword].(string)
+			if !hasSchemaType(value, typ) {
+				// the other keywords are meaningless for a wrong type
+				return []error{fmt.Errorf("%s must be of type %s", name, typ)}
+			}
+		case "enum":
+			values, _ := schema[keyword].([]any)
+			if !slices.ContainsFunc(values, func(v any) bool {
+				s, ok := value.(string)
+				return ok && v == s
+			}) {
+				errs = append(errs, fmt.Errorf("%s must be one of %v", name, values))
+			}
+		case "minimum":
+			minimum, _ := schema[keyword].(float64)
+			number, ok := value.(json.Number)
+			if f, err := number.Float64(); ok && err == nil && f < minimum {
+				errs = append(errs, fmt.Errorf("%s must be at least %v", name, minimum))
+			}
+		case "items":
+			items, _ := schema[keyword].(map[string]any)
+			values, _ := value.([]any)
+			for n, item := range values {
+				errs = append(errs, validateSchema(items, item, fmt.Sprintf("%s[%d]", name, n))...)
+			}
+		case "properties":
+			properties, _ := schema[keyword].(map[string]any)
+			object, _ := value.(map[string]any)
+			keys := make([]string, 0, len(object))
+			for key := range object {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				property, found := properties[key].(map[string]any)
+				if found {
+					errs = append(errs, validateSchema(property, object[key], strings.TrimPrefix(path+"."+key, "."))...)
+				} else if schema["additionalProperties"] == false {
+					errs = append(errs, fmt.Errorf("%s: unknown setting %q", name, key))
+				}
+			}
+		case "additionalProperties":
+			// checked with the properties
+		default:
+			if !slices.Contains(schemaAnnotations, keyword) {
+				errs = append(errs, fmt.Errorf("config schema: unsupported keyword %q at %s", keyword, name))
+			}
+		}
+	}
+	return errs
+}
+
+func hasSchemaType(value any, typ string) bool {
+	switch typ {
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "number":
+		_, ok := value.(json.Number)
+		return ok
+	case "integer":
+		number, ok := value.(json.Number)
+		if !ok {
+			return false
+		}
+		_, err := number.Int64()
+		return err == nil
+	default:
+		return false
+	}
+}
@@ -0,0 +1,169 @@
+package main_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	main "github.com/anton15x/dropbox_ignore_service"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseConfig(t *testing.T) {
+	CheckTestParallel(t)
+
+	root := t.TempDir()
+	c, err := main.ParseConfig([]byte(`{"roots": [` + jsonString(t, root) + `], "reconcile": {"interval": "1h"}}`))
+	requireNoError(t, err)
+	expected := main.DefaultConfig()
+	expected.Roots = []string{root}
+	expected.Reconcile.Interval = main.Duration(time.Hour)
+	require.Equal(t, expected, c)
+
+	for name, data := range map[string]string{
+		"unknown setting":  `{"unknown": true}`,
+		"relative root":    `{"roots": ["Dropbox"]}`,
+		"account and root": `{"account": "personal", "roots": [` + jsonString(t, root) + `]}`,
+		"unknown account":  `{"account": "team"}`,
+		"unknown backend":  `{"watcher": {"backend": "fast"}}`,
+		"zero poll":        `{"watcher": {"pollInterval": "0s"}}`,
+		"bad duration":     `{"reconcile": {"interval": 5}}`,
+		"negative workers": `{"workers": -1}`,
+		"trailing data":    `{} {}`,
+	} {
+		_, err := main.ParseConfig([]byte(data))
+		require.Error(t, err, name)
+	}
+}
+
+func TestValidateConfigSchema(t *testing.T) {
+	CheckTestParallel(t)
+
+	data, err := json.Marshal(main.DefaultConfig())
+	requireNoError(t, err)
+	requireNoError(t, main.ValidateConfigSchema(data))
+
+	for data, expected := range map[string]string{
+		`[]`:                                    "config must be of type object",
+		`{"unknown": true}`:                     `config: unknown setting "unknown"`,
+		`{"log": {"unknown": true}}`:            `log: unknown setting "unknown"`,
+		`{"tryRun": "yes"}`:                     "tryRun must be of type boolean",
+		`{"workers": 1.5}`:                      "workers must be of type integer",
+		`{"workers": -1}`:                       "workers must be at least 0",
+		`{"log": {"format": "xml"}}`:            "log.format must be one of [text json]",
+		`{"watcher": {"pollRoots": ["/a", 1]}}`: "watcher.pollRoots[1] must be of type string",
+	} {
+		err := main.ValidateConfigSchema([]byte(data))
+		require.ErrorContains(t, err, expected, data)
+	}
+}
+
+func jsonString(t *testing.T, s string) string {
+	data, err := json.Marshal(s)
+	requireNoError(t, err)
+	return string(data)
+}
+
+// TestConfigSchema keeps config.schema.json in sync with Config
+func TestConfigSchema(t *testing.T) {
+	CheckTestParallel(t)
+
+	var schema struct {
+		Properties map[string]struct {
+			Properties map[string]any `json:"properties"`
+		} `json:"properties"`
+	}
+	requireNoError(t, json.Unmarshal(main.ConfigSchema, &schema))
+
+	jsonFields := func(typ reflect.Type) []string {
+		fields := []string{}
+		for n := 0; n < typ.NumField(); n++ {
+			name, _, _ := strings.Cut(typ.Field(n).Tag.Get("json"), ",")
+			fields = append(fields, name)
+		}
+		sort.Strings(fields)
+		return fields
+	}
+	keys := func(m map[string]any) []string {
+		names := []string{}
+		for name := range m {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return names
+	}
+
+	configType := reflect.TypeOf(main.Config{})
+	var names []string
+	for name := range schema.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	require.Equal(t, jsonFields(configType), names)
+	for n := 0; n < configType.NumField(); n++ {
+		field := configType.Field(n)
+		if field.Type.Kind() != reflect.Struct {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		require.Equal(t, jsonFields(field.Type), keys(schema.Properties[name].Properties), name)
+	}
+}
+
+func TestConfigStore(t *testing.T) {
+	CheckTestParallel(t)
+
+	tmpTestDir := t.TempDir()
+	path := filepath.Join(tmpTestDir, "config.json")
+	overrides := func(c *main.Config) {
+		c.Workers = 2
+	}
+
+	// a missing config file is the default config
+	s, err := main.NewConfigStore(path, overrides)
+	requireNoError(t, err)
+	expected := main.DefaultConfig()
+	expected.Workers = 2
+	require.Equal(t, expected, s.Config())
+
+	changes := make(chan main.Config, 10)
+	s.AddChangeEventListener(func(old main.Config, new main.Config) {
+		changes <- new
+	})
+	ctx, ctxCancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	defer func() {
+		ctxCancel()
+		wg.Wait()
+	}()
+	s.Watch(ctx, &wg, 10*time.Millisecond, NewTestLogger(t))
+
+	requireNoError(t, s.Save([]byte(`{"tryRun": true, "workers": 8}`)))
+	c := readChanTimeout(t, changes, time.Second, "config change")
+	require.True(t, c.TryRun)
+	// the command line flags take precedence over the config file
+	require.Equal(t, 2, c.Workers)
+	require.True(t, s.Config().TryRun)
+
+	// an invalid config file is not saved
+	require.Error(t, s.Save([]byte(`{"tryRun": 1}`)))
+	data, err := s.ReadFile()
+	requireNoError(t, err)
+	require.Equal(t, `{"tryRun": true, "workers": 8}`, string(data))
+
+	// a config file changed by an editor is reloaded, an invalid one keeps the current config
+	requireNoError(t, os.WriteFile(path, []byte(`{"tryRun": false}`), os.ModePerm))
+	c = readChanTimeout(t, changes, time.Second, "config change")
+	require.False(t, c.TryRun)
+	requireNoError(t, os.WriteFile(path, []byte(`{"tryRun": "yes"}`), os.ModePerm))
+	require.Error(t, s.Reload())
+	require.False(t, s.Config().TryRun)
+	require.Empty(t, changes)
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ControlSocketEnv overrides the location of the control socket
+const ControlSocketEnv = "DROPBOX_IGNORE_SERVICE_SOCKET"
+
+const controlSocketName = "dropbox_ignore_service.sock"
+
+// controlServiceName is the prefix of the json-rpc methods, e.g. "Control.Status"
+const controlServiceName = "Control"
+
+const controlDialTimeout = time.Second
+
+const controlDialRetryInterval = 200 * time.Millisecond
+
+// ControlSocketPath returns the location of the control socket of the running service.
+// The socket is created in a directory, that only the user may access.
+func ControlSocketPath() string {
+	if path, found := os.LookupEnv(ControlSocketEnv); found && path != "" {
+		return path
+	}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, controlSocketName)
+	}
+	// windows uses a unix socket as well instead of a named pipe, the standard library has no named pipes.
+	// Unix sockets are supported since windows 10, the user cache dir is %LOCALAPPDATA%.
+	dir, err := os.UserCacheDir()
+	if err == nil {
+		return filepath.Join(dir, "dropbox_ignore_service", controlSocketName)
+	}
+	if runtime.GOOS == "windows" {
+		// the temp dir of windows belongs to the user
+		return filepath.Join(os.TempDir(), "dropbox_ignore_service", controlSocketName)
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("dropbox_ignore_service-%d", os.Getuid()), controlSocketName)
+}
+
+// ControlArgs are the arguments of every control method.
+// Roots selects the dropbox folders, all of the running service if empty.
+type ControlArgs struct {
+	Roots []string `json:"roots"`
+	// Paths are the absolute paths of Explain and the absolute paths or globs of Unignore
+	Paths []string `json:"paths"`
+}
+
+// ControlService is the json-rpc api of the running service
+type ControlService struct {
+	manager *RootManager
+	// config is nil if the service has no config file
+	config *ConfigStore
+
+	listenersMutex sync.Mutex
+	onShowWindow   []func()
+}
+
+// addShowWindowEventListener is called, if a second launch requests the window of the running service.
+// Every exported method must be a json-rpc method, net/rpc logs the others.
+func (s *ControlService) addShowWindowEventListener(f func()) {
+	s.listenersMutex.Lock()
+	defer s.listenersMutex.Unlock()
+
+	s.onShowWindow = append(s.onShowWindow, f)
+}
+
+// ShowWindow shows the window of the running service, reply is false if it has none
+func (s *ControlService) ShowWindow(args ControlArgs, reply *bool) error {
+	s.listenersMutex.Lock()
+	listeners := slices.Clone(s.onShowWindow)
+	s.listenersMutex.Unlock()
+	for _, f := range listeners {
+		f()
+	}
+	*reply = len(listeners) > 0
+	return nil
+}
+
+func (s *ControlService) ignorers(roots []string) ([]*DropboxIgnorer, error) {
+	ignorers := s.manager.Ignorers()
+	if len(roots) == 0 {
+		return ignorers, nil
+	}
+	selected := []*DropboxIgnorer{}
+	for _, root := range roots {
+		i := ignorerOf(ignorers, root)
+		if i == nil || i.DropboxPath() != root {
+			return nil, fmt.Errorf("the running service does not handle %s", root)
+		}
+		selected = append(selected, i)
+	}
+	return selected, nil
+}
+
+func (s *ControlService) Status(args ControlArgs, reply *[]RootStatus) error {
+	ignorers, err := s.ignorers(args.Roots)
+	if err != nil {
+		return err
+	}
+	*reply = []RootStatus{}
+	for _, i := range ignorers {
+		*reply = append(*reply, rootStatus(i, i.LastDriftReport(), true))
+	}
+	return nil
+}
+
+func (s *ControlService) ListIgnored(args ControlArgs, reply *[]string) error {
+	ignorers, err := s.ignorers(args.Roots)
+	if err != nil {
+		return err
+	}
+	*reply = []string{}
+	for _, i := range ignorers {
+		*reply = append(*reply, i.IgnoredPathsSet().Values()...)
+	}
+	return nil
+}
+
+func (s *ControlService) Explain(args ControlArgs, reply *[]PathExplanation) error {
+	ignorers, err := s.ignorers(args.Roots)
+	if err != nil {
+		return err
+	}
+	*reply = []PathExplanation{}
+	for _, path := range args.Paths {
+		i := ignorerOf(ignorers, path)
+		if i == nil {
+			return fmt.Errorf("%s is not inside a dropbox folder", path)
+		}
+		e, err := i.Explain(path)
+		if err != nil {
+			return err
+		}
+		*reply = append(*reply, e)
+	}
+	return nil
+}
+
+func (s *ControlService) Pause(args ControlArgs, reply *[]string) error {
+	return s.eachIgnorer(args, reply, (*DropboxIgnorer).Pause)
+}
+
+func (s *ControlService) Resume(args ControlArgs, reply *[]string) error {
+	return s.eachIgnorer(args, reply, (*DropboxIgnorer).Resume)
+}
+
+func (s *ControlService) Rescan(args ControlArgs, reply *[]string) error {
+	return s.eachIgnorer(args, reply, (*DropboxIgnorer).Rescan)
+}
+
+// eachIgnorer calls f for the selected ignorers, reply are their dropbox folders
+func (s *ControlService) eachIgnorer(args ControlArgs, reply *[]string, f func(i *DropboxIgnorer)) error {
+	ignorers, err := s.ignorers(args.Roots)
+	if err != nil {
+		return err
+	}
+	*reply = []string{}
+	for _, i := range ignorers {
+		f(i)
+		*reply = append(*reply, i.DropboxPath())
+	}
+	return nil
+}
+
+func (s *ControlService) Unignore(args ControlArgs, reply *[]UnignoredPath) error {
+	ignorers, err := s.ignorers(args.Roots)
+	if err != nil {
+		return err
+	}
+	roots := make([]string, len(ignorers))
+	for n, i := range ignorers {
+		roots[n] = i.DropboxPath()
+	}
+	paths, err := globUnignorePaths(roots, args.Paths)
+	if err != nil {
+		return err
+	}
+	*reply = []UnignoredPath{}
+	for _, path := range paths {
+		// the ignorer must forget the path, otherwise it sets the flag again
+		unignored, err := ignorerOf(ignorers, path).Unignore([]string{path})
+		if err != nil {
+			return err
+		}
+		*reply = append(*reply, unignored...)
+	}
+	return nil
+}
+
+// Reload reads the config file and the dropbox config file again, reply are the handled dropbox folders
+func (s *ControlService) Reload(args ControlArgs, reply *[]string) error {
+	var err error
+	if s.config != nil {
+		// a changed config is applied by the listeners of the config store
+		err = s.config.Reload()
+	}
+	err = errors.Join(err, s.manager.Sync())
+	*reply = s.manager.IgnoredPathsSet().Roots()
+	return err
+}
+
+// ignorerOf returns the ignorer of the dropbox folder containing path, nil if there is none
+func ignorerOf(ignorers []*DropboxIgnorer, path string) *DropboxIgnorer {
+	for _, i := range ignorers {
+		if isInsideRoots([]string{i.DropboxPath()}, path) {
+			return i
+		}
+	}
+	return nil
+}
+
+// ServeControl serves the ControlService of manager on the unix socket path until ctx is done, config may be nil
+func ServeControl(ctx context.Context, wg *sync.WaitGroup, path string, manager *RootManager, config *ConfigStore, logger *slog.Logger) (*ControlService, error) {
+	conn, err := net.DialTimeout("unix", path, controlDialTimeout)
+	if err == nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("another instance is listening on %s", path)
+	}
+	// a crashed instance leaves its socket behind
+	err = os.Remove(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("error removing old control socket: %w", err)
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0o700)
+	if err != nil {
+		return nil, fmt.Errorf("error creating dir of control socket: %w", err)
+	}
+	// the socket is created with the umask, only the dir keeps the other users out
+	err = checkPrivateDir(filepath.Dir(path))
+	if err != nil {
+		return nil, fmt.Errorf("error checking dir of control socket: %w", err)
+	}
+
+	service := &ControlService{manager: manager, config: config}
+	server := rpc.NewServer()
+	err = server.RegisterName(controlServiceName, service)
+	if err != nil {
+		return nil, fmt.Errorf("error registering control service: %w", err)
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("error listening on control socket: %w", err)
+	}
+	if runtime.GOOS != "windows" {
+		err = os.Chmod(path, 0o600)
+		if err != nil {
+			_ = listener.Close()
+			return nil, fmt.Errorf("error changing permissions of control socket: %w", err)
+		}
+	}
+	logger = componentLogger(logger, LogComponentControl)
+	logger.Info("control api listening", "socket", path)
+
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		<-ctx.Done()
+		// removes the socket file as well
+		_ = listener.Close()
+	}()
+	go func() {
+		defer wg.Done()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if ctx.Err() == nil {
+					logger.Error("accepting control connection failed", LogKeyError, err)
+				}
+				return
+			}
+			go server.ServeCodec(jsonrpc.NewServerCodec(conn))
+		}
+	}()
+	return service, nil
+}
+
+// ControlClient calls the ControlService of the running service
+type ControlClient struct {
+	client *rpc.Client
+}
+
+func DialControl(path string) (*ControlClient, error) {
+	conn, err := net.DialTimeout("unix", path, controlDialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return &ControlClient{client: jsonrpc.NewClient(conn)}, nil
+}
+
+// DialRunningInstance connects to the control socket of the process holding the lock file lockPath.
+// The running service starts its control api after the initial walk, the dial is retried until timeout while it holds the lock.
+func DialRunningInstance(lockPath string, timeout time.Duration) (*ControlClient, InstanceInfo, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		info, err := ReadInstanceInfo(lockPath)
+		if err != nil {
+			// the lock got released
+			return nil, InstanceInfo{}, err
+		}
+		if info.Socket == "" {
+			return nil, info, fmt.Errorf("pid %d runs without control api", info.PID)
+		}
+		client, err := DialControl(info.Socket)
+		if err == nil {
+			return client, info, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, info, err
+		}
+		time.Sleep(controlDialRetryInterval)
+	}
+}
+
+func (c *ControlClient) Close() error {
+	return c.client.Close()
+}
+
+func callControl[T any](c *ControlClient, method string, args ControlArgs) (T, error) {
+	var reply T
+	err := c.client.Call(controlServiceName+"."+method, args, &reply)
+	return reply, err
+}
+
+func (c *ControlClient) Status(args ControlArgs) ([]RootStatus, error) {
+	return callControl[[]RootStatus](c, "Status", args)
+}
+
+func (c *ControlClient) ListIgnored(args ControlArgs) ([]string, error) {
+	return callControl[[]string](c, "ListIgnored", args)
+}
+
+func (c *ControlClient) Explain(args ControlArgs) ([]PathExplanation, error) {
+	return callControl[[]PathExplanation](c, "Explain", args)
+}
+
+func (c *ControlClient) Pause(args ControlArgs) ([]string, error) {
+	return callControl[[]string](c, "Pause", args)
+}
+
+func (c *ControlClient) Resume(args ControlArgs) ([]string, error) {
+	return callControl[[]string](c, "Resume", args)
+}
+
+func (c *ControlClient) Rescan(args ControlArgs) ([]string, error) {
+	return callControl[[]string](c, "Rescan", args)
+}
+
+func (c *ControlClient) Unignore(args ControlArgs) ([]UnignoredPath, error) {
+	return callControl[[]UnignoredPath](c, "Unignore", args)
+}
+
+func (c *ControlClient) ShowWindow(args ControlArgs) (bool, error) {
+	return callControl[bool](c, "ShowWindow", args)
+}
+
+func (c *ControlClient) Reload(args ControlArgs) ([]string, error) {
+	return callControl[[]string](c, "Reload", args)
+}
@@ -0,0 +1,204 @@
+package main_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	main "github.com/anton15x/dropbox_ignore_service"
+	"github.com/stretchr/testify/require"
+)
+
+func TestControl(t *testing.T) {
+	CheckTestParallel(t)
+
+	tmpTestDir := t.TempDir()
+	root := filepath.Join(tmpTestDir, "dropbox")
+	ignoredDir := filepath.Join(root, "node_modules")
+	flaggedFile := filepath.Join(root, "notes.txt")
+	createDropboxignore(t, filepath.Join(root, main.DropboxIgnoreFilename), "node_modules")
+	requireMkdir(t, ignoredDir)
+	requireNoError(t, os.WriteFile(flaggedFile, nil, os.ModePerm))
+	requireNoError(t, main.SetDropboxIgnoreFlag(flaggedFile))
+	socket := filepath.Join(tmpTestDir, "run", "control.sock")
+
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	var wg sync.WaitGroup
+	defer func() {
+		ctxCancel()
+		wg.Wait()
+		_, err := os.Stat(socket)
+		require.ErrorIs(t, err, os.ErrNotExist)
+	}()
+	findRoots := func() ([]string, error) {
+		return []string{root}, nil
+	}
+	ignorerOptions := func(root string) main.IgnorerOptions {
+		return main.IgnorerOptions{}
+	}
+	m := main.NewRootManager(ctx, &wg, NewTestLogger(t), main.NewEventBus(), findRoots, ignorerOptions)
+	requireNoError(t, m.Sync())
+	_, err := main.ServeControl(ctx, &wg, socket, m, nil, NewTestLogger(t))
+	requireNoError(t, err)
+	_, err = main.ServeControl(ctx, &wg, socket, m, nil, NewTestLogger(t))
+	require.Error(t, err, "second instance")
+
+	client, err := main.DialControl(socket)
+	requireNoError(t, err)
+	defer client.Close()
+
+	// there is no gui
+	shown, err := client.ShowWindow(main.ControlArgs{})
+	requireNoError(t, err)
+	require.False(t, shown)
+
+	status, err := client.Status(main.ControlArgs{})
+	requireNoError(t, err)
+	require.Len(t, status, 1)
+	require.True(t, status[0].Running)
+	require.Equal(t, 1, status[0].IgnoredPaths)
+	_, err = client.Status(main.ControlArgs{Roots: []string{tmpTestDir}})
+	require.Error(t, err)
+
+	explanations, err := client.Explain(main.ControlArgs{Paths: []string{filepath.Join(ignoredDir, "a"), flaggedFile}})
+	requireNoError(t, err)
+	require.Equal(t, []main.PathExplanation{
+		{
+			Root:          root,
+			Path:          filepath.Join(ignoredDir, "a"),
+			Ignored:       true,
+			IgnoreFile:    filepath.Join(root, main.DropboxIgnoreFilename),
+			Rule:          filepath.Join(root, "**", "node_modules"),
+			IgnoredParent: ignoredDir,
+		},
+		{Root: root, Path: flaggedFile, Flagged: true},
+	}, explanations)
+
+	roots, err := client.Pause(main.ControlArgs{Roots: []string{root}})
+	requireNoError(t, err)
+	require.Equal(t, []string{root}, roots)
+	require.True(t, m.Ignorers()[0].Paused())
+	_, err = client.Resume(main.ControlArgs{})
+	requireNoError(t, err)
+	require.False(t, m.Ignorers()[0].Paused())
+
+	unignored, err := client.Unignore(main.ControlArgs{Paths: []string{filepath.Join(root, "*.txt")}})
+	requireNoError(t, err)
+	require.Equal(t, []main.UnignoredPath{{Path: flaggedFile, Unignored: true}}, unignored)
+
+	// the commands are thin clients of the running service
+	var out bytes.Buffer
+	requireNoError(t, main.RunCommand([]string{"list-ignored", "-json", "-socket", socket}, &out))
+	var ignored []string
+	requireNoError(t, json.Unmarshal(out.Bytes(), &ignored))
+	require.Equal(t, []string{ignoredDir}, ignored)
+
+	// the running ignorer does not set the flag of an unignored path again
+	unignored, err = client.Unignore(main.ControlArgs{Paths: []string{ignoredDir}})
+	requireNoError(t, err)
+	require.Equal(t, []main.UnignoredPath{{Path: ignoredDir, Unignored: true}}, unignored)
+	time.Sleep(500 * time.Millisecond)
+	hasFlag, err := main.HasDropboxIgnoreFlag(ignoredDir)
+	requireNoError(t, err)
+	require.False(t, hasFlag)
+	require.False(t, m.IgnoredPathsSet().Has(ignoredDir))
+	require.Equal(t, int64(0), m.Ignorers()[0].FlagsStrippedCount())
+	err = main.RunCommand([]string{"rescan", "-socket", filepath.Join(tmpTestDir, "missing.sock")}, &out)
+	require.Error(t, err)
+}
+
+// TestDialRunningInstance checks, that a second launch waits for the control api of the starting service
+func TestDialRunningInstance(t *testing.T) {
+	CheckTestParallel(t)
+
+	tmpTestDir := t.TempDir()
+	socket := filepath.Join(tmpTestDir, "run", "control.sock")
+	lockPath := socket + ".lock"
+	logger := NewTestLogger(t)
+
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	var wg sync.WaitGroup
+	defer func() {
+		ctxCancel()
+		wg.Wait()
+	}()
+	m := main.NewRootManager(ctx, &wg, logger, main.NewEventBus(), func() ([]string, error) {
+		return nil, nil
+	}, func(root string) main.IgnorerOptions {
+		return main.IgnorerOptions{}
+	})
+
+	lock, err := main.AcquireInstanceLock(lockPath, main.InstanceInfo{PID: os.Getpid(), Socket: socket, Started: time.Now()}, logger)
+	requireNoError(t, err)
+	// the initial walk is still running
+	_, _, err = main.DialRunningInstance(lockPath, 0)
+	require.Error(t, err)
+	go func() {
+		time.Sleep(500 * time.Millisecond)
+		_, err := main.ServeControl(ctx, &wg, socket, m, nil, logger)
+		if err != nil {
+			t.Error(err)
+		}
+	}()
+	client, info, err := main.DialRunningInstance(lockPath, 20*time.Second)
+	requireNoError(t, err)
+	require.Equal(t, os.Getpid(), info.PID)
+	_, err = client.Status(main.ControlArgs{})
+	requireNoError(t, err)
+	requireNoError(t, client.Close())
+
+	// the service exited
+	requireNoError(t, lock.Release())
+	_, _, err = main.DialRunningInstance(lockPath, 20*time.Second)
+	require.Error(t, err)
+}
+
+func TestServeControlPrivateDir(t *testing.T) {
+	CheckTestParallel(t)
+	if runtime.GOOS == "windows" {
+		t.Skip("windows has no file modes")
+	}
+
+	sharedDir := filepath.Join(t.TempDir(), "shared")
+	requireMkdir(t, sharedDir)
+	requireNoError(t, os.Chmod(sharedDir, 0o755))
+
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	var wg sync.WaitGroup
+	defer func() {
+		ctxCancel()
+		wg.Wait()
+	}()
+	m := main.NewRootManager(ctx, &wg, NewTestLogger(t), main.NewEventBus(), func() ([]string, error) {
+		return nil, nil
+	}, func(root string) main.IgnorerOptions {
+		return main.IgnorerOptions{}
+	})
+	_, err := main.ServeControl(ctx, &wg, filepath.Join(sharedDir, "control.sock"), m, nil, NewTestLogger(t))
+	require.Error(t, err, "other users may access the socket")
+
+	socket := filepath.Join(sharedDir, "private", "control.sock")
+	_, err = main.ServeControl(ctx, &wg, socket, m, nil, NewTestLogger(t))
+	requireNoError(t, err)
+	info, err := os.Stat(filepath.Dir(socket))
+	requireNoError(t, err)
+	require.Equal(t, os.FileMode(0o700), info.Mode().Perm())
+
+	// a private dir created by another user before
+	if os.Getuid() != 0 {
+		t.Skip("only root can create a dir of another user")
+	}
+	foreignDir := filepath.Join(sharedDir, "foreign")
+	requireNoError(t, os.Mkdir(foreignDir, 0o700))
+	requireNoError(t, os.Chown(foreignDir, 1, 1))
+	_, err = main.ServeControl(ctx, &wg, filepath.Join(foreignDir, "control.sock"), m, nil, NewTestLogger(t))
+	require.ErrorContains(t, err, "owned by another user")
+	_, err = main.AcquireInstanceLock(filepath.Join(foreignDir, "control.sock.lock"), main.InstanceInfo{PID: os.Getpid()}, NewTestLogger(t))
+	require.ErrorContains(t, err, "owned by another user")
+}
@@ -2,11 +2,17 @@ module.exports = {
     "version": "0.2",
     "language": "en",
     "words": [
+        "afpfs",
         "APPDATA",
         "bmatcuk",
+        "cifs",
         "coverprofile",
         "dropboxignore",
         "doublestar",
+        "EWOULDBLOCK",
+        "Flatpak",
+        "Flock",
+        "Fstypename",
         "fyne",
         "fsnotify",
         "globbing",
@@ -14,21 +20,35 @@ module.exports = {
         "golint",
         "gofmt",
         "goweight",
+        "gpfs",
         "Hinterhofer",
+        "inotify",
         "jondot",
+        "jsonrpc",
+        "kafs",
         "kichik",
+        "KMGTPE",
+        "kqueue",
         "LOCALAPPDATA",
+        "LOCKFILE",
+        "macfuse",
         "nolint",
+        "osxfuse",
         "ouzi-dev",
         "rjeczalik",
+        "smbfs",
         "sp1thas",
         "spiretechnology",
+        "statfs",
         "stretchr",
         "systray",
         "unignore", // not a correct word...
         "unignoreable", // not a correct word...
+        "unignored",
+        "unignoring",
         "USERPROFILE",
         "xattr",
+        "XDG",
         "xorg",
         "xquartz",
     ],
@@ -5,62 +5,222 @@ import (
 	"errors"
 	"fmt"
 	"io/fs"
-	"log"
+	"log/slog"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/anton15x/dropbox_ignore_service/src/fsnotify"
 )
 
 const DropboxIgnoreFilename = ".dropboxignore"
 
+// OverflowRescanMinInterval rate limits the full rescans after the file watcher lost events
+const OverflowRescanMinInterval = time.Minute
+
+// a failed file watcher gets recreated with an exponential backoff between the tries
+const (
+	WatcherRestartMinBackoff = time.Second
+	WatcherRestartMaxBackoff = time.Minute
+)
+
+// ErrWatcherRestarting answers the requests, that need the file watcher, while it is restarted
+var ErrWatcherRestarting = errors.New("file watcher is restarting")
+
+// watcherHealthCheckInterval is the interval the existence of the dropbox folder gets checked
+const watcherHealthCheckInterval = 10 * time.Second
+
+// scanProgressInterval is the number of walked paths between two ScanProgress events
+const scanProgressInterval = 1000
+
+// maxPausedPaths is the number of paths recorded while paused, more changes are reconciled by a rescan at resume
+const maxPausedPaths = 10000
+
+// watcherFatalErrorCount errors within watcherErrorWindow restart the watcher
+const (
+	watcherFatalErrorCount = 10
+	watcherErrorWindow     = time.Minute
+)
+
+type WatcherState int32
+
+const (
+	// WatcherStateHealthy the file watcher is running
+	WatcherStateHealthy WatcherState = iota
+	// WatcherStateDegraded the file watcher is running, but reported errors recently
+	WatcherStateDegraded
+	// WatcherStateRestarting the file watcher failed (or the dropbox folder disappeared) and gets recreated
+	WatcherStateRestarting
+)
+
+func (s WatcherState) String() string {
+	switch s {
+	case WatcherStateHealthy:
+		return "healthy"
+	case WatcherStateDegraded:
+		return "degraded"
+	case WatcherStateRestarting:
+		return "restarting"
+	default:
+		return fmt.Sprintf("WatcherState(%d)", int32(s))
+	}
+}
+
+// IgnorerOptions are the settings of a DropboxIgnorer, they can not change while it runs
+type IgnorerOptions struct {
+	TryRun  bool
+	Watcher fsnotify.Options
+	// CaseInsensitive matches the ignore rules case-insensitively
+	CaseInsensitive bool
+	// Workers is the number of directories read in parallel by reconcile walks and plans (default: runtime.NumCPU())
+	Workers int
+}
+
 type DropboxIgnorer struct {
-	dropboxPath string
-	tryRun      bool
+	dropboxPath     string
+	tryRun          bool
+	caseInsensitive bool
+	workers         int
 
 	ignorePatterns map[string]IgnorePattern
 	watcher        *fsnotify.Watcher
+	watcherOptions fsnotify.Options
 
 	ctx    context.Context
 	wg     *sync.WaitGroup
-	logger *log.Logger
+	logger *slog.Logger
+	// watcherLogger logs the file watcher state with its own level
+	watcherLogger *slog.Logger
 
 	ignoreFiles     *SortedStringSet
 	ignoredPathsSet *SortedStringSet
+	// alreadyUploadedSet contains ignored paths dropbox synced before they got flagged
+	alreadyUploadedSet *SortedStringSet
+
+	events *EventBus
+
+	// overflowRescanRequests is handled by the event loop, ignorePatterns are not thread safe
+	overflowRescanRequests  chan struct{}
+	overflowRescanScheduled bool
+	lastOverflowRescan      time.Time
+	overflowRescanCount     atomic.Int64
+
+	watcherState     atomic.Int32
+	lastWatcherError atomic.Int64
+
+	flagsStrippedCount atomic.Int64
+
+	// paused ignorers only record the touched paths, the event loop reconciles them after a resume request
+	paused         atomic.Bool
+	resumeRequests chan struct{}
+	pausedPaths    map[string]bool
+	pausedRescan   bool
+
+	reconcileRequests chan reconcileRequest
+	reconcileResults  chan reconcileResult
+	lastDriftReport   atomic.Pointer[DriftReport]
+
+	rescanRequests   chan struct{}
+	explainRequests  chan explainRequest
+	unignoreRequests chan unignoreRequest
+
+	listenersMutex       sync.Mutex
+	onOverflowRescan     []func()
+	onWatcherStateChange []func(WatcherState)
+	onFlagStripped       []func(path string)
+	onPauseChange        []func(paused bool)
+	onDriftReport        []func(DriftReport)
+}
+
+func NewDropboxIgnorer(dropboxPath string, tryRun bool, logger *slog.Logger, ctx context.Context, wg *sync.WaitGroup, events *EventBus, watcherOptions fsnotify.Options) (*DropboxIgnorer, error) {
+	return newDropboxIgnorer(dropboxPath, logger, ctx, wg, events, IgnorerOptions{TryRun: tryRun, Watcher: watcherOptions}, false, true)
 }
 
-func NewDropboxIgnorer(dropboxPath string, tryRun bool, logger *log.Logger, ctx context.Context, wg *sync.WaitGroup, ignoredPathsSet *SortedStringSet, ignoreFiles *SortedStringSet) (*DropboxIgnorer, error) {
+// NewDropboxIgnorerWithOptions is NewDropboxIgnorer or NewPausedDropboxIgnorer with all options
+func NewDropboxIgnorerWithOptions(dropboxPath string, logger *slog.Logger, ctx context.Context, wg *sync.WaitGroup, events *EventBus, options IgnorerOptions, paused bool) (*DropboxIgnorer, error) {
+	return newDropboxIgnorer(dropboxPath, logger, ctx, wg, events, options, paused, true)
+}
+
+// NewPausedDropboxIgnorer skips the initial walk, the dropbox folder is scanned at Resume
+func NewPausedDropboxIgnorer(dropboxPath string, tryRun bool, logger *slog.Logger, ctx context.Context, wg *sync.WaitGroup, events *EventBus, watcherOptions fsnotify.Options) (*DropboxIgnorer, error) {
+	return newDropboxIgnorer(dropboxPath, logger, ctx, wg, events, IgnorerOptions{TryRun: tryRun, Watcher: watcherOptions}, true, true)
+}
+
+// ScanDropbox walks dropboxPath once without a file watcher, the error of the walk is returned.
+// ListenForEvents must not be called on the returned ignorer.
+func ScanDropbox(dropboxPath string, tryRun bool, logger *slog.Logger, ctx context.Context, events *EventBus) (*DropboxIgnorer, error) {
+	return newDropboxIgnorer(dropboxPath, logger, ctx, &sync.WaitGroup{}, events, IgnorerOptions{TryRun: tryRun}, false, false)
+}
+
+func newDropboxIgnorer(dropboxPath string, logger *slog.Logger, ctx context.Context, wg *sync.WaitGroup, events *EventBus, options IgnorerOptions, paused bool, watch bool) (*DropboxIgnorer, error) {
 	dropboxPathAbs, err := filepath.Abs(dropboxPath)
 	if err != nil {
 		return nil, fmt.Errorf("error getting absolute path of %s: %w", dropboxPath, err)
 	}
 	dropboxPath = dropboxPathAbs
 
-	watcher, err := fsnotify.NewWatcherRecursive(dropboxPath)
-	if err != nil {
-		return nil, fmt.Errorf("error creating file watcher: %w", err)
+	// every dropbox folder has its own state, the gui combines them with RootAwareSet
+	ignoredPathsSet := NewSortedStringSet()
+	watcherOptions := options.Watcher
+	watcherOptions.Filter = watcherEventFilter(ignoredPathsSet, watcherOptions.Filter)
+	var watcher *fsnotify.Watcher
+	if watch {
+		watcher, err = fsnotify.NewWatcherRecursiveWithOptions(dropboxPath, watcherOptions)
+		if err != nil {
+			return nil, fmt.Errorf("error creating file watcher: %w", err)
+		}
+		componentLogger(logger, LogComponentWatcher).Info("using file watcher", LogKeyRoot, dropboxPath, "backend", watcher.Backend())
 	}
 
 	i := &DropboxIgnorer{
 		dropboxPath:     dropboxPath,
-		tryRun:          tryRun,
+		tryRun:          options.TryRun,
+		caseInsensitive: options.CaseInsensitive,
+		workers:         options.Workers,
 		ignorePatterns:  map[string]IgnorePattern{},
-		logger:          logger,
+		logger:          componentLogger(logger, LogComponentIgnorer).With(LogKeyRoot, dropboxPath),
+		watcherLogger:   componentLogger(logger, LogComponentWatcher).With(LogKeyRoot, dropboxPath),
 		ctx:             ctx,
 		wg:              wg,
 		watcher:         watcher,
-		ignoreFiles:     ignoreFiles,
+		watcherOptions:  watcherOptions,
+		ignoreFiles:     NewSortedStringSet(),
 		ignoredPathsSet: ignoredPathsSet,
+
+		alreadyUploadedSet: NewSortedStringSet(),
+		events:             events,
+
+		overflowRescanRequests: make(chan struct{}, 1),
+		resumeRequests:         make(chan struct{}, 1),
+		reconcileRequests:      make(chan reconcileRequest),
+		reconcileResults:       make(chan reconcileResult),
+		rescanRequests:         make(chan struct{}, 1),
+		explainRequests:        make(chan explainRequest),
+		unignoreRequests:       make(chan unignoreRequest),
+		pausedPaths:            map[string]bool{},
+	}
+
+	if paused {
+		i.paused.Store(true)
+		i.pausedRescan = true
+		i.logger.Info("started paused, initial walk is done at resume")
+		return i, nil
 	}
 
-	i.logger.Printf("initial walk started for %s", i.dropboxPath)
-	err = i.checkDirForIgnore(i.dropboxPath, false)
+	i.logger.Info("initial walk started")
+	err = i.checkDirForIgnore(i.dropboxPath, false, CauseInitialScan)
+	if err != nil && !watch {
+		return nil, fmt.Errorf("error walking %s: %w", i.dropboxPath, err)
+	}
 	if err != nil {
-		i.logger.Printf("Error at initial files walk of folder %s: %s", i.dropboxPath, err)
+		i.logger.Error("initial walk failed", LogKeyError, err)
 	}
-	i.logger.Printf("initial walk finished for %s", i.dropboxPath)
+	i.logger.Info("initial walk finished")
 
 	return i, nil
 }
@@ -71,17 +231,194 @@ func (i *DropboxIgnorer) IgnoredPathsSet() *SortedStringSet {
 func (i *DropboxIgnorer) IgnoreFiles() *SortedStringSet {
 	return i.ignoreFiles
 }
+func (i *DropboxIgnorer) AlreadyUploadedSet() *SortedStringSet {
+	return i.alreadyUploadedSet
+}
+func (i *DropboxIgnorer) Events() *EventBus {
+	return i.events
+}
+
+func (i *DropboxIgnorer) publish(e IgnorerEvent) {
+	e.Root = i.dropboxPath
+	i.events.Publish(e)
+}
 func (i *DropboxIgnorer) TryRun() bool {
 	return i.tryRun
 }
 func (i *DropboxIgnorer) DropboxPath() string {
 	return i.dropboxPath
 }
-func (i *DropboxIgnorer) Logger() *log.Logger {
+func (i *DropboxIgnorer) Logger() *slog.Logger {
 	return i.logger
 }
 
-func (i *DropboxIgnorer) checkDirForIgnore(rootPath string, skipRootIgnoreFile bool) error {
+// OverflowRescanCount returns how often the dropbox folder got rescanned, because the file watcher lost events
+func (i *DropboxIgnorer) OverflowRescanCount() int64 {
+	return i.overflowRescanCount.Load()
+}
+
+func (i *DropboxIgnorer) AddOverflowRescanEventListener(f func()) {
+	i.listenersMutex.Lock()
+	defer i.listenersMutex.Unlock()
+
+	i.onOverflowRescan = append(i.onOverflowRescan, f)
+}
+
+// FlagsStrippedCount returns how often another program removed the ignore flag of an ignored path
+func (i *DropboxIgnorer) FlagsStrippedCount() int64 {
+	return i.flagsStrippedCount.Load()
+}
+
+func (i *DropboxIgnorer) AddFlagStrippedEventListener(f func(path string)) {
+	i.listenersMutex.Lock()
+	defer i.listenersMutex.Unlock()
+
+	i.onFlagStripped = append(i.onFlagStripped, f)
+}
+
+func (i *DropboxIgnorer) flagStripped(path string) {
+	i.flagsStrippedCount.Add(1)
+	i.logger.Warn("flag stripped externally, set it again", LogKeyPath, path)
+
+	i.listenersMutex.Lock()
+	listeners := slices.Clone(i.onFlagStripped)
+	i.listenersMutex.Unlock()
+	for _, f := range listeners {
+		f(path)
+	}
+}
+
+func (i *DropboxIgnorer) Paused() bool {
+	return i.paused.Load()
+}
+
+// Pause stops acting on changes, they are recorded and reconciled at Resume
+func (i *DropboxIgnorer) Pause() {
+	if i.paused.Swap(true) {
+		return
+	}
+	i.logger.Info("paused, changes are handled at resume")
+	i.pauseChanged(true)
+}
+
+func (i *DropboxIgnorer) Resume() {
+	if !i.paused.Swap(false) {
+		return
+	}
+	i.logger.Info("resumed")
+	select {
+	case i.resumeRequests <- struct{}{}:
+	default:
+		// already requested
+	}
+	i.pauseChanged(false)
+}
+
+// Rescan walks the dropbox folder again, a paused ignorer rescans at resume
+func (i *DropboxIgnorer) Rescan() {
+	select {
+	case i.rescanRequests <- struct{}{}:
+	default:
+		// already requested
+	}
+}
+
+func (i *DropboxIgnorer) AddPauseEventListener(f func(paused bool)) {
+	i.listenersMutex.Lock()
+	defer i.listenersMutex.Unlock()
+
+	i.onPauseChange = append(i.onPauseChange, f)
+}
+
+func (i *DropboxIgnorer) pauseChanged(paused bool) {
+	i.listenersMutex.Lock()
+	listeners := slices.Clone(i.onPauseChange)
+	i.listenersMutex.Unlock()
+	for _, f := range listeners {
+		f(paused)
+	}
+}
+
+func (i *DropboxIgnorer) recordPausedEvent(path string) {
+	if i.pausedRescan {
+		return
+	}
+	if len(i.pausedPaths) >= maxPausedPaths {
+		i.logger.Info("too many changes while paused, rescanning at resume", "max", maxPausedPaths)
+		i.pausedRescan = true
+		clear(i.pausedPaths)
+		return
+	}
+	i.pausedPaths[path] = true
+}
+
+func (i *DropboxIgnorer) handleResumeRequest() {
+	if i.paused.Load() {
+		// paused again in the meantime
+		return
+	}
+
+	if i.pausedRescan {
+		i.pausedRescan = false
+		clear(i.pausedPaths)
+		i.logger.Info("rescanning after resume")
+		err := i.rescan(CauseResume)
+		if err != nil && !errors.Is(err, i.ctx.Err()) {
+			i.logger.Error("rescan after resume failed", LogKeyError, err)
+		}
+		return
+	}
+
+	paths := make([]string, 0, len(i.pausedPaths))
+	for path := range i.pausedPaths {
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+	clear(i.pausedPaths)
+	i.logger.Info("reconciling changed paths after resume", "count", len(paths))
+
+	// the walked directories, sorted paths => parents are checked before their children
+	var dirs []string
+	for _, path := range paths {
+		_, err := os.Stat(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				i.handleRemovedPath(path, CauseResume)
+			} else {
+				i.logger.Error("stat failed", LogKeyPath, path, LogKeyError, err)
+			}
+			continue
+		}
+
+		if filepath.Base(path) == DropboxIgnoreFilename {
+			path = filepath.Dir(path)
+		}
+		if slices.ContainsFunc(dirs, func(dir string) bool {
+			return path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+		}) {
+			continue
+		}
+		if i.IsInsideIgnoreDir(path) {
+			continue
+		}
+		dirs = append(dirs, path)
+	}
+	for _, dir := range dirs {
+		err := i.checkDirForIgnore(dir, false, CauseResume)
+		if err != nil && !errors.Is(err, i.ctx.Err()) {
+			i.logger.Error("reconcile after resume failed", LogKeyPath, dir, LogKeyError, err)
+		}
+	}
+}
+
+func (i *DropboxIgnorer) checkDirForIgnore(rootPath string, skipRootIgnoreFile bool, cause EventCause) error {
+	// only walks of the whole dropbox folder are published as scan, not the walks of new directories
+	fullScan := rootPath == i.dropboxPath
+	count := 0
+	if fullScan {
+		i.publish(IgnorerEvent{Type: EventScanStarted, Path: rootPath, Cause: cause})
+	}
+
 	err := filepath.WalkDir(rootPath, func(path string, info fs.DirEntry, err error) error {
 		if err != nil {
 			if os.IsNotExist(err) {
@@ -94,19 +431,24 @@ func (i *DropboxIgnorer) checkDirForIgnore(rootPath string, skipRootIgnoreFile b
 			return fmt.Errorf("program is shutting down at file walk: %w", err)
 		}
 
+		count++
+		if fullScan && count%scanProgressInterval == 0 {
+			i.publish(IgnorerEvent{Type: EventScanProgress, Path: path, Cause: cause, Count: count})
+		}
+
 		if info.IsDir() {
 			if !skipRootIgnoreFile || path != rootPath {
-				_, err := i.addIgnoreFileIfExists(filepath.Join(path, DropboxIgnoreFilename))
+				_, err := i.addIgnoreFileIfExists(filepath.Join(path, DropboxIgnoreFilename), cause)
 				if err != nil {
-					i.logger.Printf("error adding ignore file: %s", err)
+					i.logger.Error("adding ignore file failed", LogKeyError, err)
 				}
 			}
 		}
 
 		if i.ShouldPathGetIgnored(path) {
-			err = i.SetIgnoreFlag(path)
+			err = i.SetIgnoreFlag(path, cause)
 			if err != nil {
-				i.logger.Printf("Error ignoring dir %s: %s", path, err)
+				i.logger.Error("ignoring path failed", LogKeyPath, path, LogKeyError, err)
 			}
 
 			return filepath.SkipDir
@@ -115,27 +457,31 @@ func (i *DropboxIgnorer) checkDirForIgnore(rootPath string, skipRootIgnoreFile b
 		return nil
 	})
 	if err != nil {
-		return fmt.Errorf("error walking dir %s: %w", rootPath, err)
+		err = fmt.Errorf("error walking dir %s: %w", rootPath, err)
+	}
+	if fullScan {
+		i.publish(IgnorerEvent{Type: EventScanFinished, Path: rootPath, Cause: cause, Count: count, Err: err})
 	}
 
-	return nil
+	return err
 }
 
-func (i *DropboxIgnorer) removeIgnoreFile(ignoreFile string) {
+func (i *DropboxIgnorer) removeIgnoreFile(ignoreFile string, cause EventCause) {
 	delete(i.ignorePatterns, filepath.Dir(ignoreFile))
 	i.ignoreFiles.Remove(ignoreFile)
 
 	for _, path := range i.ignoreFiles.Values() {
 		if !i.ShouldPathGetIgnored(path) {
-			i.ignoredPathsSet.Remove(path)
+			i.removeIgnoredPath(path, CauseIgnoreFileEdit)
 		}
 	}
 
-	i.logger.Printf("removed %s file %s", DropboxIgnoreFilename, ignoreFile)
+	i.logger.Info("removed ignore file", LogKeyPath, ignoreFile)
+	i.publish(IgnorerEvent{Type: EventIgnoreFileRemoved, Path: ignoreFile, IgnoreFile: ignoreFile, Cause: cause})
 }
 
-func (i *DropboxIgnorer) addIgnoreFileIfExists(ignoreFile string) (bool, error) {
-	added, err := i.addIgnoreFile(ignoreFile)
+func (i *DropboxIgnorer) addIgnoreFileIfExists(ignoreFile string, cause EventCause) (bool, error) {
+	added, err := i.addIgnoreFile(ignoreFile, cause)
 	if err != nil && !os.IsNotExist(err) {
 		return false, fmt.Errorf("error reading ignore file %s: %w", ignoreFile, err)
 	}
@@ -143,7 +489,7 @@ func (i *DropboxIgnorer) addIgnoreFileIfExists(ignoreFile string) (bool, error)
 	return added, nil
 }
 
-func (i *DropboxIgnorer) addIgnoreFile(ignoreFile string) (bool, error) {
+func (i *DropboxIgnorer) addIgnoreFile(ignoreFile string, cause EventCause) (bool, error) {
 	ignoreFileBytes, err := os.ReadFile(ignoreFile)
 	if err != nil {
 		return false, err
@@ -152,7 +498,9 @@ func (i *DropboxIgnorer) addIgnoreFile(ignoreFile string) (bool, error) {
 
 	patterns, err := ParseIgnoreFileFromBytes(ignoreFile, ignoreFileBytes)
 	if err != nil {
-		return false, fmt.Errorf("error parsing ignore file %s: %w", ignoreFile, err)
+		err = fmt.Errorf("error parsing ignore file %s: %w", ignoreFile, err)
+		i.publish(IgnorerEvent{Type: EventIgnoreFileInvalid, Path: ignoreFile, IgnoreFile: ignoreFile, Cause: cause, Err: err})
+		return false, err
 	}
 
 	oldPatterns := i.ignorePatterns[filepath.Dir(ignoreFile)]
@@ -168,7 +516,8 @@ func (i *DropboxIgnorer) addIgnoreFile(ignoreFile string) (bool, error) {
 	}
 
 	i.ignorePatterns[filepath.Dir(ignoreFile)] = patterns
-	i.logger.Printf("added %s file %s: %+v", DropboxIgnoreFilename, ignoreFile, patterns)
+	i.logger.Info("added ignore file", LogKeyPath, ignoreFile, "rules", patterns)
+	i.publish(IgnorerEvent{Type: EventIgnoreFileAdded, Path: ignoreFile, IgnoreFile: ignoreFile, Cause: cause})
 
 	return true, nil
 }
@@ -178,86 +527,388 @@ func (i *DropboxIgnorer) ListenForEvents() {
 	go func() {
 		defer i.wg.Done()
 
-		var listenForEventsWg sync.WaitGroup
-		defer func() {
-			listenForEventsWg.Wait()
-			err := i.watcher.Close()
-			if err != nil {
-				i.logger.Printf("Error closing watcher: %s", err)
+		backoff := WatcherRestartMinBackoff
+		for {
+			started := time.Now()
+			err := i.runWatcher()
+			if i.ctx.Err() != nil {
+				return
 			}
-		}()
-
-		listenForEventsWg.Add(1)
-		go func() {
-			defer listenForEventsWg.Done()
+			i.watcherLogger.Error("file watcher failed", LogKeyError, err)
+			i.publish(IgnorerEvent{Type: EventWatcherError, Path: i.dropboxPath, Cause: CauseWatcherFailure, Err: err})
+			i.setWatcherState(WatcherStateRestarting)
 
+			if time.Since(started) > WatcherRestartMaxBackoff {
+				// the watcher was running fine for a while
+				backoff = WatcherRestartMinBackoff
+			}
 			for {
-				select {
-				case <-i.ctx.Done():
+				i.watcherLogger.Info("restarting file watcher", "in", backoff)
+				if !i.waitForRestart(backoff) {
 					return
-				case err, ok := <-i.watcher.Errors:
-					if !ok {
-						return
-					}
-					i.logger.Printf("watcher error: %s", err)
 				}
+				backoff = min(2*backoff, WatcherRestartMaxBackoff)
+
+				err := i.restartWatcher()
+				if err == nil {
+					break
+				}
+				if i.ctx.Err() != nil {
+					return
+				}
+				i.watcherLogger.Error("restarting file watcher failed", LogKeyError, err)
+				i.publish(IgnorerEvent{Type: EventWatcherError, Path: i.dropboxPath, Cause: CauseWatcherRestart, Err: err})
+			}
+			i.setWatcherState(WatcherStateHealthy)
+		}
+	}()
+}
+
+// waitForRestart answers the requests of the event loop until the backoff is over, false if the program shuts down.
+// The restart rescans the dropbox folder, the requested rescans are dropped.
+func (i *DropboxIgnorer) waitForRestart(backoff time.Duration) bool {
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-i.ctx.Done():
+			return false
+		case <-timer.C:
+			return true
+		case <-i.overflowRescanRequests:
+		case <-i.rescanRequests:
+		case <-i.resumeRequests:
+			if !i.paused.Load() {
+				// the restart rescans everything, that changed while paused
+				i.pausedRescan = false
+				clear(i.pausedPaths)
 			}
-		}()
+		case r := <-i.reconcileRequests:
+			now := time.Now()
+			r.report <- DriftReport{Root: i.dropboxPath, Started: now, Finished: now, Err: ErrWatcherRestarting}
+		case result := <-i.reconcileResults:
+			// the watcher of the fixed paths is gone
+			result.fix = false
+			i.handleReconcileResult(result)
+		case r := <-i.explainRequests:
+			// the ignore rules do not need the watcher
+			r.explanation <- i.explain(r.path)
+		case r := <-i.unignoreRequests:
+			r.result <- unignoreResult{err: ErrWatcherRestarting}
+		}
+	}
+}
+
+// runWatcher handles the events of the current watcher until it fails or the program shuts down.
+// The watcher is closed afterwards.
+func (i *DropboxIgnorer) runWatcher() error {
+	watcher := i.watcher
+
+	stop := make(chan struct{})
+	fatalErrors := make(chan error, 1)
+	var listenForEventsWg sync.WaitGroup
+	defer func() {
+		close(stop)
+		listenForEventsWg.Wait()
+		err := watcher.Close()
+		if err != nil {
+			i.watcherLogger.Error("closing file watcher failed", LogKeyError, err)
+		}
+	}()
+
+	listenForEventsWg.Add(1)
+	go func() {
+		defer listenForEventsWg.Done()
 
-		// Block until an event is received.
+		var errorTimes []time.Time
 		for {
 			select {
-			case <-i.ctx.Done():
+			case <-stop:
 				return
-			case ei := <-i.watcher.Events:
-				i.handleEvent(ei)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					fatalErrors <- errors.New("watcher error channel closed")
+					return
+				}
+				i.watcherLogger.Warn("file watcher error", LogKeyError, err)
+				i.publish(IgnorerEvent{Type: EventWatcherError, Path: i.dropboxPath, Err: err})
+				if errors.Is(err, fsnotify.ErrEventOverflow) {
+					i.requestOverflowRescan()
+					continue
+				}
+
+				now := time.Now()
+				i.lastWatcherError.Store(now.UnixNano())
+				i.setWatcherState(WatcherStateDegraded)
+
+				errorTimes = slices.DeleteFunc(errorTimes, func(t time.Time) bool {
+					return now.Sub(t) > watcherErrorWindow
+				})
+				errorTimes = append(errorTimes, now)
+				if len(errorTimes) >= watcherFatalErrorCount {
+					fatalErrors <- fmt.Errorf("%d watcher errors within %s, last error: %w", len(errorTimes), watcherErrorWindow, err)
+					return
+				}
 			}
 		}
 	}()
+
+	healthCheckTicker := time.NewTicker(watcherHealthCheckInterval)
+	defer healthCheckTicker.Stop()
+
+	// Block until an event is received.
+	for {
+		select {
+		case <-i.ctx.Done():
+			return i.ctx.Err()
+		case err := <-fatalErrors:
+			return err
+		case ei, ok := <-watcher.Events:
+			if !ok {
+				return errors.New("watcher event channel closed")
+			}
+			if i.paused.Load() {
+				i.recordPausedEvent(ei.Name)
+			} else {
+				i.handleEvent(ei)
+			}
+			if ei.Name == i.dropboxPath && (ei.Op.Has(fsnotify.Remove) || ei.Op.Has(fsnotify.Rename)) {
+				err := i.checkDropboxPathExists()
+				if err != nil {
+					return err
+				}
+			}
+		case <-i.overflowRescanRequests:
+			if i.paused.Load() {
+				// the lost events are caught up at resume
+				i.pausedRescan = true
+				continue
+			}
+			i.handleOverflowRescanRequest()
+		case <-i.resumeRequests:
+			i.handleResumeRequest()
+		case r := <-i.reconcileRequests:
+			i.handleReconcileRequest(r)
+		case result := <-i.reconcileResults:
+			i.handleReconcileResult(result)
+		case <-i.rescanRequests:
+			if i.paused.Load() {
+				i.pausedRescan = true
+				continue
+			}
+			i.logger.Info("rescan requested")
+			err := i.rescan(CauseRescanRequest)
+			if err != nil {
+				i.logger.Error("rescan failed", LogKeyError, err)
+			}
+		case r := <-i.explainRequests:
+			r.explanation <- i.explain(r.path)
+		case r := <-i.unignoreRequests:
+			i.handleUnignoreRequest(r)
+		case <-healthCheckTicker.C:
+			err := i.checkDropboxPathExists()
+			if err != nil {
+				return err
+			}
+			lastError := time.Unix(0, i.lastWatcherError.Load())
+			if i.WatcherState() == WatcherStateDegraded && time.Since(lastError) > watcherErrorWindow {
+				i.setWatcherState(WatcherStateHealthy)
+			}
+		}
+	}
+}
+
+func (i *DropboxIgnorer) checkDropboxPathExists() error {
+	info, err := os.Stat(i.dropboxPath)
+	if err != nil {
+		return fmt.Errorf("dropbox folder is not accessible (unmounted?): %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("dropbox folder %s is not a directory", i.dropboxPath)
+	}
+	return nil
+}
+
+// restartWatcher replaces the failed watcher and catches up with the changes, that happened in the meantime
+func (i *DropboxIgnorer) restartWatcher() error {
+	err := i.checkDropboxPathExists()
+	if err != nil {
+		return err
+	}
+
+	watcher, err := fsnotify.NewWatcherRecursiveWithOptions(i.dropboxPath, i.watcherOptions)
+	if err != nil {
+		return fmt.Errorf("error creating file watcher: %w", err)
+	}
+	i.watcher = watcher
+	i.watcherLogger.Info("using file watcher", "backend", watcher.Backend())
+
+	if i.paused.Load() {
+		i.pausedRescan = true
+		return nil
+	}
+	i.logger.Info("rescanning after file watcher restart")
+	err = i.rescan(CauseWatcherRestart)
+	if err != nil && !errors.Is(err, i.ctx.Err()) {
+		i.logger.Error("rescan after file watcher restart failed", LogKeyError, err)
+	}
+	i.logger.Info("rescan finished")
+
+	return nil
+}
+
+func (i *DropboxIgnorer) WatcherState() WatcherState {
+	return WatcherState(i.watcherState.Load())
+}
+
+func (i *DropboxIgnorer) AddWatcherStateEventListener(f func(WatcherState)) {
+	i.listenersMutex.Lock()
+	defer i.listenersMutex.Unlock()
+
+	i.onWatcherStateChange = append(i.onWatcherStateChange, f)
+}
+
+func (i *DropboxIgnorer) setWatcherState(state WatcherState) {
+	oldState := WatcherState(i.watcherState.Swap(int32(state)))
+	if oldState == state {
+		return
+	}
+	i.watcherLogger.Info("file watcher state changed", "from", oldState, "to", state)
+
+	i.listenersMutex.Lock()
+	listeners := slices.Clone(i.onWatcherStateChange)
+	i.listenersMutex.Unlock()
+	for _, f := range listeners {
+		f(state)
+	}
+}
+
+func (i *DropboxIgnorer) requestOverflowRescan() {
+	select {
+	case i.overflowRescanRequests <- struct{}{}:
+	default:
+		// already requested
+	}
+}
+
+func (i *DropboxIgnorer) handleOverflowRescanRequest() {
+	wait := time.Until(i.lastOverflowRescan.Add(OverflowRescanMinInterval))
+	if wait > 0 {
+		if !i.overflowRescanScheduled {
+			i.watcherLogger.Warn("file watcher lost events, rescan scheduled", "in", wait.Round(time.Second))
+			i.overflowRescanScheduled = true
+			time.AfterFunc(wait, i.requestOverflowRescan)
+		}
+		return
+	}
+
+	i.overflowRescanScheduled = false
+	i.lastOverflowRescan = time.Now()
+	i.overflowRescanCount.Add(1)
+	i.watcherLogger.Warn("file watcher lost events, rescanning")
+
+	i.listenersMutex.Lock()
+	listeners := slices.Clone(i.onOverflowRescan)
+	i.listenersMutex.Unlock()
+	for _, f := range listeners {
+		f()
+	}
+
+	err := i.rescan(CauseOverflowRescan)
+	if err != nil && !errors.Is(err, i.ctx.Err()) {
+		i.logger.Error("rescan after lost events failed", LogKeyError, err)
+	}
+	i.logger.Info("rescan finished")
+}
+
+// rescan catches up with all changes, the file watcher did not report
+func (i *DropboxIgnorer) rescan(cause EventCause) error {
+	dropboxPathWithSeparator := i.dropboxPath + string(filepath.Separator)
+	for _, ignoreFile := range i.ignoreFiles.ValuesWithPrefix(dropboxPathWithSeparator) {
+		_, err := os.Stat(ignoreFile)
+		if os.IsNotExist(err) {
+			i.removeIgnoreFile(ignoreFile, cause)
+		}
+	}
+	for _, path := range i.ignoredPathsSet.ValuesWithPrefix(dropboxPathWithSeparator) {
+		_, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			i.removeIgnoredPath(path, cause)
+		}
+	}
+
+	return i.checkDirForIgnore(i.dropboxPath, false, cause)
+}
+
+// watcherEventFilter drops the write and chmod events which handleEvent ignores already in the watcher goroutine,
+// next is an additional filter that may be nil
+func watcherEventFilter(ignoredPathsSet *SortedStringSet, next func(path string, op fsnotify.Op) bool) func(path string, op fsnotify.Op) bool {
+	return func(path string, op fsnotify.Op) bool {
+		if op == fsnotify.Write && filepath.Base(path) != DropboxIgnoreFilename {
+			return false
+		}
+		if op == fsnotify.Chmod && !ignoredPathsSet.Has(path) {
+			return false
+		}
+		return next == nil || next(path, op)
+	}
 }
 
 func (i *DropboxIgnorer) handleEvent(ei fsnotify.Event) {
-	i.logger.Printf("got event: %s %s", ei.Op.String(), ei.Name)
+	i.logger.Debug("got event", LogKeyOp, ei.Op.String(), LogKeyPath, ei.Name)
 	path := ei.Name
 	if !strings.HasPrefix(path, i.dropboxPath) {
 		_, after, found := strings.Cut(path, i.dropboxPath)
 		if found {
 			path = filepath.Join(i.dropboxPath, after)
 		} else {
-			i.logger.Printf("dropbox %s got event not containing dropbox path: %s", i.dropboxPath, path)
+			i.logger.Warn("got event outside of the dropbox folder", LogKeyPath, path)
 		}
 	}
 
 	event := ei.Op
+	if event.Has(fsnotify.Chmod) && !i.tryRun && i.ignoredPathsSet.Has(path) && i.ShouldPathGetIgnored(path) {
+		// e.g. rsync without -X or a backup restore dropped the flag
+		// the set may still contain a path, whose rule got removed from its ignore file
+		// errors are ignored, a removed path is handled by its remove event
+		hasFlag, err := HasDropboxIgnoreFlag(path)
+		if err == nil && !hasFlag {
+			err = i.SetIgnoreFlag(path, CauseWatcherEvent)
+			if err != nil {
+				i.logger.Error("ignoring path failed", LogKeyPath, path, LogKeyError, err)
+			}
+		}
+	}
 	if event.Has(fsnotify.Create) || event.Has(fsnotify.Rename) || (event.Has(fsnotify.Write) && filepath.Base(path) == DropboxIgnoreFilename) {
 		// info: rename event is triggered for both, the new AND old name => stat to check if path exists
 		info, err := os.Stat(path)
 		if err != nil {
 			if !os.IsNotExist(err) {
-				i.logger.Printf("stat for path failed: %s", err)
+				i.logger.Error("stat failed", LogKeyPath, path, LogKeyError, err)
 			}
 		} else {
 			if filepath.Base(path) == DropboxIgnoreFilename {
-				added, err := i.addIgnoreFile(path)
+				added, err := i.addIgnoreFile(path, CauseWatcherEvent)
 				if err != nil {
-					i.logger.Printf("Error adding ignore file: %s", err)
+					i.logger.Error("adding ignore file failed", LogKeyPath, path, LogKeyError, err)
 				}
 				if added {
-					err = i.checkDirForIgnore(filepath.Dir(path), true)
+					err = i.checkDirForIgnore(filepath.Dir(path), true, CauseIgnoreFileEdit)
 					if err != nil && !errors.Is(err, i.ctx.Err()) {
-						i.logger.Printf("Error handling ignore file subdirectories of %s: %s", path, err)
+						i.logger.Error("walking subdirectories failed", LogKeyPath, path, LogKeyError, err)
 					}
 				}
 			} else if i.ShouldPathGetIgnored(path) {
-				err := i.SetIgnoreFlag(path)
+				err := i.SetIgnoreFlag(path, CauseWatcherEvent)
 				if err != nil {
-					i.logger.Printf("Error ignoring dir %s: %s", path, err)
+					i.logger.Error("ignoring path failed", LogKeyPath, path, LogKeyError, err)
 				}
 			} else if info.IsDir() {
 				// created/renamed directory => check for sub directories
-				err = i.checkDirForIgnore(path, false)
+				err = i.checkDirForIgnore(path, false, CauseWatcherEvent)
 				if err != nil && !errors.Is(err, i.ctx.Err()) {
-					i.logger.Printf("Error handling ignore file subdirectories of %s: %s", path, err)
+					i.logger.Error("walking subdirectories failed", LogKeyPath, path, LogKeyError, err)
 				}
 			}
 		}
@@ -268,39 +919,40 @@ func (i *DropboxIgnorer) handleEvent(ei fsnotify.Event) {
 		_, err := os.Stat(path)
 		if err != nil {
 			if !os.IsNotExist(err) {
-				i.logger.Printf("Error stating file: %s", err)
+				i.logger.Error("stat failed", LogKeyPath, path, LogKeyError, err)
 			} else {
-				// remove is single element only
-				// rename could cause sub directories to get removed
-				// but handle both scenarios es they could have subdirectories
-				pathWithSeparatorSuffix := path
-				if !strings.HasSuffix(path, string(filepath.Separator)) {
-					pathWithSeparatorSuffix += string(filepath.Separator)
-				}
-
-				i.ignoredPathsSet.Remove(path)
-				for _, subFolderPath := range i.ignoredPathsSet.Values() {
-					if strings.HasPrefix(subFolderPath, pathWithSeparatorSuffix) {
-						i.ignoredPathsSet.Remove(subFolderPath)
-					}
-				}
-
-				if filepath.Base(path) == DropboxIgnoreFilename {
-					i.removeIgnoreFile(path)
-				}
-				for _, ignoreFile := range i.ignoreFiles.Values() {
-					if strings.HasPrefix(ignoreFile, pathWithSeparatorSuffix) {
-						i.removeIgnoreFile(ignoreFile)
-					}
-				}
+				i.handleRemovedPath(path, CausePathRemoved)
 			}
 		}
 	}
 }
 
-func (i *DropboxIgnorer) SetIgnoreFlag(path string) error {
+// handleRemovedPath forgets the ignored paths and ignore files of the removed path
+func (i *DropboxIgnorer) handleRemovedPath(path string, cause EventCause) {
+	// remove is single element only
+	// rename could cause sub directories to get removed
+	// but handle both scenarios es they could have subdirectories
+	pathWithSeparatorSuffix := path
+	if !strings.HasSuffix(path, string(filepath.Separator)) {
+		pathWithSeparatorSuffix += string(filepath.Separator)
+	}
+
+	i.removeIgnoredPath(path, cause)
+	for _, subFolderPath := range i.ignoredPathsSet.ValuesWithPrefix(pathWithSeparatorSuffix) {
+		i.removeIgnoredPath(subFolderPath, cause)
+	}
+
+	if filepath.Base(path) == DropboxIgnoreFilename {
+		i.removeIgnoreFile(path, cause)
+	}
+	for _, ignoreFile := range i.ignoreFiles.ValuesWithPrefix(pathWithSeparatorSuffix) {
+		i.removeIgnoreFile(ignoreFile, cause)
+	}
+}
+
+func (i *DropboxIgnorer) SetIgnoreFlag(path string, cause EventCause) error {
 	if i.IsInsideIgnoreDir(path) {
-		i.logger.Printf("dir is already inside ignore dir %s", path)
+		i.logger.Debug("path is already inside an ignored dir", LogKeyPath, path)
 		return nil
 	}
 
@@ -317,18 +969,94 @@ func (i *DropboxIgnorer) SetIgnoreFlag(path string) error {
 		return fmt.Errorf("error checking if path %s already has ignore flag: %w", path, err)
 	}
 
-	defer i.ignoredPathsSet.Add(path)
+	i.checkAlreadyUploaded(path)
+	known := i.ignoredPathsSet.Has(path)
+	stripped := false
 	if i.tryRun {
-		i.logger.Printf("tryRun: would ignore dir %s", path)
-		return nil
-	}
-	i.logger.Printf("ignoring dir %s", path)
+		i.logger.Info("tryRun: would ignore path", LogKeyPath, path)
+	} else {
+		i.logger.Info("ignoring path", LogKeyPath, path)
 
-	if hasFlag {
 		// already has flag => do not set again
-		return nil
+		if !hasFlag {
+			err = SetDropboxIgnoreFlag(path)
+			if known {
+				stripped = true
+				cause = CauseFlagStripped
+				i.flagStripped(path)
+			}
+		}
+	}
+	i.addIgnoredPath(path)
+
+	if !known || stripped {
+		ignoreFile, rule, _ := i.matchingIgnoreRule(path)
+		i.publish(IgnorerEvent{
+			Type:           EventPathIgnored,
+			Path:           path,
+			Cause:          cause,
+			IgnoreFile:     ignoreFile,
+			Rule:           rule,
+			TryRun:         i.tryRun,
+			AlreadyFlagged: hasFlag,
+			Err:            err,
+		})
+	}
+	return err
+}
+
+// checkAlreadyUploaded reports ignored paths, that dropbox synced before they got flagged, they stay in the cloud
+func (i *DropboxIgnorer) checkAlreadyUploaded(path string) {
+	uploaded, err := HasDropboxSyncAttributes(path)
+	if err != nil {
+		i.logger.Error("checking dropbox sync attributes failed", LogKeyPath, path, LogKeyError, err)
+		return
+	}
+	if !uploaded {
+		i.alreadyUploadedSet.Remove(path)
+		return
+	}
+	if i.alreadyUploadedSet.Add(path) {
+		i.logger.Warn("ignored but already uploaded — delete from dropbox.com to reclaim space", LogKeyPath, path)
+	}
+}
+
+// addIgnoredPath also stops watching the content of path, events inside an ignored dir are never acted on
+func (i *DropboxIgnorer) addIgnoredPath(path string) {
+	i.ignoredPathsSet.Add(path)
+	if i.watcher == nil {
+		return
+	}
+
+	err := i.watcher.Exclude(path)
+	if err != nil {
+		i.watcherLogger.Error("excluding ignored path from file watcher failed", LogKeyPath, path, LogKeyError, err)
+	}
+}
+
+func (i *DropboxIgnorer) removeIgnoredPath(path string, cause EventCause) {
+	i.alreadyUploadedSet.Remove(path)
+	if !i.ignoredPathsSet.Remove(path) {
+		return
+	}
+	i.publish(IgnorerEvent{Type: EventPathUnignored, Path: path, Cause: cause})
+	if i.watcher == nil {
+		return
+	}
+
+	err := i.watcher.Include(path)
+	if err != nil {
+		i.watcherLogger.Error("including unignored path in file watcher failed", LogKeyPath, path, LogKeyError, err)
+	}
+}
+
+// ignoreRulesSnapshot returns a copy of the ignore rules, that can match paths outside of the event loop
+func (i *DropboxIgnorer) ignoreRulesSnapshot() *DropboxIgnorer {
+	return &DropboxIgnorer{
+		dropboxPath:     i.dropboxPath,
+		caseInsensitive: i.caseInsensitive,
+		ignorePatterns:  maps.Clone(i.ignorePatterns),
 	}
-	return SetDropboxIgnoreFlag(path)
 }
 
 func (i *DropboxIgnorer) IsInsideIgnoreDir(path string) bool {
@@ -355,20 +1083,29 @@ func (i *DropboxIgnorer) ShouldPathGetIgnored(path string) bool {
 }
 
 func (i *DropboxIgnorer) isPathIgnoredByPattern(path string) bool {
+	_, _, ok := i.matchingIgnoreRule(path)
+	return ok
+}
+
+// matchingIgnoreRule returns the ignore file and its pattern, that ignore path
+func (i *DropboxIgnorer) matchingIgnoreRule(path string) (string, string, bool) {
 	currentDir := path
 	for {
-		pattern := i.ignorePatterns[currentDir]
-		isIgnored := IsIgnored(pattern, path)
+		matchingPattern := MatchingPattern
+		if i.caseInsensitive {
+			matchingPattern = MatchingPatternFold
+		}
+		pattern, isIgnored := matchingPattern(i.ignorePatterns[currentDir], path)
 		if isIgnored {
-			return true
+			return filepath.Join(currentDir, DropboxIgnoreFilename), pattern, true
 		}
 
 		newDir := filepath.Dir(currentDir)
 		if newDir == currentDir {
-			return false
+			return "", "", false
 		}
 		if currentDir == i.dropboxPath {
-			return false
+			return "", "", false
 		}
 		currentDir = newDir
 	}
@@ -3,17 +3,18 @@ package main_test
 import (
 	"context"
 	"fmt"
-	"io"
-	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	main "github.com/anton15x/dropbox_ignore_service"
+	"github.com/anton15x/dropbox_ignore_service/src/fsnotify"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -28,12 +29,12 @@ func sleepToEnsureEvents() {
 }
 
 type testLog struct {
-	t *testing.T
+	t       *testing.T
+	discard atomic.Bool
 }
 
-func NewTestLogger(t *testing.T) *log.Logger {
-	// return log.Default()
-	return log.New(NewTestLog(t), t.Name(), log.LstdFlags)
+func NewTestLogger(t *testing.T) *slog.Logger {
+	return NewTestLog(t).Logger()
 }
 
 func NewTestLog(t *testing.T) *testLog {
@@ -42,8 +43,19 @@ func NewTestLog(t *testing.T) *testLog {
 	}
 }
 
+func (l *testLog) Logger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(l, &slog.HandlerOptions{Level: slog.LevelDebug}))
+}
+
+// Discard drops the following logs, e.g. of large tests
+func (l *testLog) Discard() {
+	l.discard.Store(true)
+}
+
 func (l *testLog) Write(p []byte) (n int, err error) {
-	l.t.Log(strings.TrimSuffix(string(p), "\n"))
+	if !l.discard.Load() {
+		l.t.Log(strings.TrimSuffix(string(p), "\n"))
+	}
 	return len(p), nil
 }
 
@@ -62,6 +74,7 @@ type fileTester struct {
 	t                      *testing.T
 	m                      map[string]bool
 	i                      *main.DropboxIgnorer
+	log                    *testLog
 	ignoredPathsChan       <-chan string
 	ignoredPathsChanRemove <-chan string
 	ignoreFilesChan        <-chan string
@@ -410,9 +423,10 @@ func TestDropboxIgnorerListenEvents(t *testing.T) {
 
 	// TODO: test matrix?
 	testVariants := []struct {
-		name          string
-		initialCreate bool
-		tryRun        bool
+		name           string
+		initialCreate  bool
+		tryRun         bool
+		watcherOptions fsnotify.Options
 	}{
 		{
 			name:          "initial_create_normal",
@@ -434,6 +448,18 @@ func TestDropboxIgnorerListenEvents(t *testing.T) {
 			initialCreate: false,
 			tryRun:        true,
 		},
+		{
+			name:           "initial_create_polling",
+			initialCreate:  true,
+			tryRun:         false,
+			watcherOptions: fsnotify.Options{Backend: fsnotify.BackendPolling, PollInterval: 100 * time.Millisecond},
+		},
+		{
+			name:           "watch_only_polling",
+			initialCreate:  false,
+			tryRun:         false,
+			watcherOptions: fsnotify.Options{Backend: fsnotify.BackendPolling, PollInterval: 100 * time.Millisecond},
+		},
 	}
 
 	tmpTestDir := t.TempDir()
@@ -471,9 +497,7 @@ func TestDropboxIgnorerListenEvents(t *testing.T) {
 				sleepToEnsureEvents()
 
 				var wg sync.WaitGroup
-				ignoredPathsSet := main.NewSortedStringSet()
-				ignoreFiles := main.NewSortedStringSet()
-				i, err := main.NewDropboxIgnorer(dropboxDir, testVariant.tryRun, logger, ctx, &wg, ignoredPathsSet, ignoreFiles)
+				i, err := main.NewDropboxIgnorer(dropboxDir, testVariant.tryRun, logger, ctx, &wg, main.NewEventBus(), testVariant.watcherOptions)
 				requireNoError(t, err)
 				defer PrintDropboxIgnorerStatsIfTestFailed(t, i)
 				wg.Wait()
@@ -819,7 +843,7 @@ func TestDropboxIgnorerIgnoreFileEdit(t *testing.T) {
 			edit: func(t *testing.T, root string, ft *fileTester) {
 				CheckTestLarge(t)
 
-				ft.i.Logger().SetOutput(io.Discard)
+				ft.log.Discard()
 
 				ft.CreateDropboxignore(filepath.Join(root, main.DropboxIgnoreFilename), "/my_project*/**/z/[a-i]*")
 				alphabet := "abcdefghijklmnopqrstuvwxyz"
@@ -891,18 +915,18 @@ func TestDropboxIgnorerIgnoreFileEdit(t *testing.T) {
 			ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
 			defer ctxCancel()
 
-			logger := NewTestLogger(t)
+			testLog := NewTestLog(t)
+			logger := testLog.Logger()
 
 			tryRun := false
 			var wg sync.WaitGroup
-			ignoredPathsSet := main.NewSortedStringSet()
-			ignoreFiles := main.NewSortedStringSet()
-			i, err := main.NewDropboxIgnorer(dropboxDir, tryRun, logger, ctx, &wg, ignoredPathsSet, ignoreFiles)
+			i, err := main.NewDropboxIgnorer(dropboxDir, tryRun, logger, ctx, &wg, main.NewEventBus(), fsnotify.Options{})
 			requireNoError(t, err)
 			defer PrintDropboxIgnorerStatsIfTestFailed(t, i)
 			wg.Wait()
 
 			ft := NewFileTester(t, i)
+			ft.log = testLog
 			test.edit(t, dropboxDir, ft)
 			ft.Check()
 
@@ -915,3 +939,262 @@ func TestDropboxIgnorerIgnoreFileEdit(t *testing.T) {
 		})
 	}
 }
+
+func TestDropboxIgnorerWatcherRestart(t *testing.T) {
+	CheckTestParallel(t)
+
+	tmpTestDir := t.TempDir()
+	dropboxDir := filepath.Join(tmpTestDir, "dropbox")
+	requireMkdir(t, dropboxDir)
+	defer PrintFileTreeIfTestFailed(t, dropboxDir)
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer ctxCancel()
+
+	createDropboxignore(t, filepath.Join(dropboxDir, main.DropboxIgnoreFilename), "node_modules")
+
+	var wg sync.WaitGroup
+	i, err := main.NewDropboxIgnorer(dropboxDir, false, NewTestLogger(t), ctx, &wg, main.NewEventBus(), fsnotify.Options{})
+	requireNoError(t, err)
+	defer PrintDropboxIgnorerStatsIfTestFailed(t, i)
+	require.Equal(t, main.WatcherStateHealthy, i.WatcherState())
+
+	watcherStates := make(chan main.WatcherState, 100)
+	i.AddWatcherStateEventListener(func(state main.WatcherState) {
+		watcherStates <- state
+	})
+	ft := NewFileTester(t, i)
+
+	// simulate an unmount
+	unmountedDir := filepath.Join(tmpTestDir, "unmounted")
+	requireNoError(t, os.Rename(dropboxDir, unmountedDir))
+	require.Equal(t, main.WatcherStateRestarting, readChanTimeout(t, watcherStates, 20*time.Second, "watcher state restarting"))
+
+	// the requests of the event loop are answered while restarting
+	explanation, err := i.Explain(filepath.Join(dropboxDir, "node_modules"))
+	requireNoError(t, err)
+	require.Equal(t, dropboxDir, explanation.Root)
+	report, err := i.Reconcile(false)
+	requireNoError(t, err)
+	require.ErrorIs(t, report.Err, main.ErrWatcherRestarting)
+	_, err = i.Unignore([]string{filepath.Join(dropboxDir, "node_modules")})
+	require.ErrorIs(t, err, main.ErrWatcherRestarting)
+	i.Rescan()
+	i.Rescan()
+
+	requireNoError(t, os.Mkdir(filepath.Join(unmountedDir, "node_modules"), os.ModePerm))
+	requireNoError(t, os.Rename(unmountedDir, dropboxDir))
+	require.Equal(t, main.WatcherStateHealthy, readChanTimeout(t, watcherStates, 20*time.Second, "watcher state healthy"))
+
+	// created while unmounted => rescan after restart
+	ft.EditFileStatus(filepath.Join(dropboxDir, "node_modules"), true)
+	// watched again
+	ft.Mkdir(filepath.Join(dropboxDir, "my_project"), false)
+	ft.Mkdir(filepath.Join(dropboxDir, "my_project", "node_modules"), true)
+
+	ctxCancel()
+	wg.Wait()
+}
+
+func TestDropboxIgnorerFlagStripped(t *testing.T) {
+	CheckTestParallel(t)
+
+	tmpTestDir := t.TempDir()
+	dropboxDir := filepath.Join(tmpTestDir, "dropbox")
+	requireMkdir(t, dropboxDir)
+	defer PrintFileTreeIfTestFailed(t, dropboxDir)
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer ctxCancel()
+
+	createDropboxignore(t, filepath.Join(dropboxDir, main.DropboxIgnoreFilename), "node_modules")
+
+	bus := main.NewEventBus()
+	events := bus.Subscribe(100)
+	var wg sync.WaitGroup
+	i, err := main.NewDropboxIgnorer(dropboxDir, false, NewTestLogger(t), ctx, &wg, bus, fsnotify.Options{})
+	requireNoError(t, err)
+	defer PrintDropboxIgnorerStatsIfTestFailed(t, i)
+
+	strippedPaths := make(chan string, 100)
+	i.AddFlagStrippedEventListener(func(path string) {
+		strippedPaths <- path
+	})
+	ft := NewFileTester(t, i)
+
+	nodeModulesDir := filepath.Join(dropboxDir, "node_modules")
+	ft.Mkdir(nodeModulesDir, true)
+
+	requireNoError(t, main.RemoveDropboxIgnoreFlag(nodeModulesDir))
+	require.Equal(t, nodeModulesDir, readChanTimeout(t, strippedPaths, 20*time.Second, "flag stripped"))
+	require.Equal(t, int64(1), i.FlagsStrippedCount())
+
+	hasFlag, err := main.HasDropboxIgnoreFlag(nodeModulesDir)
+	requireNoError(t, err)
+	require.True(t, hasFlag)
+
+	// the flag of a path, that no rule ignores anymore, is not set again
+	createDropboxignore(t, filepath.Join(dropboxDir, main.DropboxIgnoreFilename), "build")
+	for {
+		e := readChanTimeout(t, events.C, 20*time.Second, "ignore file changed")
+		if e.Type == main.EventIgnoreFileAdded && e.Cause == main.CauseWatcherEvent {
+			break
+		}
+	}
+	requireNoError(t, main.RemoveDropboxIgnoreFlag(nodeModulesDir))
+	time.Sleep(500 * time.Millisecond)
+	hasFlag, err = main.HasDropboxIgnoreFlag(nodeModulesDir)
+	requireNoError(t, err)
+	require.False(t, hasFlag)
+	require.Equal(t, int64(1), i.FlagsStrippedCount())
+
+	ctxCancel()
+	wg.Wait()
+}
+
+func TestDropboxIgnorerEvents(t *testing.T) {
+	CheckTestParallel(t)
+
+	tmpTestDir := t.TempDir()
+	dropboxDir := filepath.Join(tmpTestDir, "dropbox")
+	requireMkdir(t, dropboxDir)
+	defer PrintFileTreeIfTestFailed(t, dropboxDir)
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer ctxCancel()
+
+	ignoreFile := filepath.Join(dropboxDir, main.DropboxIgnoreFilename)
+	createDropboxignore(t, ignoreFile, "node_modules")
+	requireNoError(t, os.MkdirAll(filepath.Join(dropboxDir, "a", "node_modules"), os.ModePerm))
+
+	bus := main.NewEventBus()
+	events := bus.Subscribe(100)
+	readEvent := func(eventType main.IgnorerEventType) main.IgnorerEvent {
+		for {
+			e := readChanTimeout(t, events.C, 20*time.Second, "event %s", eventType)
+			require.Equal(t, dropboxDir, e.Root)
+			if e.Type == eventType {
+				return e
+			}
+			t.Logf("got additional event %s", e)
+		}
+	}
+
+	var wg sync.WaitGroup
+	i, err := main.NewDropboxIgnorer(dropboxDir, false, NewTestLogger(t), ctx, &wg, bus, fsnotify.Options{})
+	requireNoError(t, err)
+	defer PrintDropboxIgnorerStatsIfTestFailed(t, i)
+
+	e := readEvent(main.EventScanStarted)
+	require.Equal(t, main.CauseInitialScan, e.Cause)
+	e = readEvent(main.EventIgnoreFileAdded)
+	require.Equal(t, ignoreFile, e.IgnoreFile)
+	e = readEvent(main.EventPathIgnored)
+	require.Equal(t, filepath.Join(dropboxDir, "a", "node_modules"), e.Path)
+	require.Equal(t, main.CauseInitialScan, e.Cause)
+	require.Equal(t, ignoreFile, e.IgnoreFile)
+	require.Equal(t, filepath.ToSlash(dropboxDir)+"/**/node_modules", e.Rule)
+	require.False(t, e.TryRun)
+	require.False(t, e.AlreadyFlagged)
+	e = readEvent(main.EventScanFinished)
+	require.Nil(t, e.Err)
+
+	ft := NewFileTester(t, i)
+	ft.Mkdir(filepath.Join(dropboxDir, "b"), false)
+	ft.Mkdir(filepath.Join(dropboxDir, "b", "node_modules"), true)
+	e = readEvent(main.EventPathIgnored)
+	require.Equal(t, filepath.Join(dropboxDir, "b", "node_modules"), e.Path)
+	require.Equal(t, main.CauseWatcherEvent, e.Cause)
+
+	ft.Remove(filepath.Join(dropboxDir, "b", "node_modules"))
+	e = readEvent(main.EventPathUnignored)
+	require.Equal(t, filepath.Join(dropboxDir, "b", "node_modules"), e.Path)
+	require.Equal(t, main.CausePathRemoved, e.Cause)
+
+	requireNoError(t, os.WriteFile(ignoreFile, []byte("!node_modules"), os.ModePerm))
+	e = readEvent(main.EventIgnoreFileInvalid)
+	require.Equal(t, ignoreFile, e.IgnoreFile)
+	require.NotNil(t, e.Err)
+
+	ctxCancel()
+	wg.Wait()
+}
+
+func TestDropboxIgnorerPauseResume(t *testing.T) {
+	CheckTestParallel(t)
+
+	tmpTestDir := t.TempDir()
+	dropboxDir := filepath.Join(tmpTestDir, "dropbox")
+	requireMkdir(t, dropboxDir)
+	defer PrintFileTreeIfTestFailed(t, dropboxDir)
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer ctxCancel()
+
+	createDropboxignore(t, filepath.Join(dropboxDir, main.DropboxIgnoreFilename), "node_modules")
+	removedDir := filepath.Join(dropboxDir, "removed", "node_modules")
+	requireNoError(t, os.MkdirAll(removedDir, os.ModePerm))
+
+	var wg sync.WaitGroup
+	i, err := main.NewDropboxIgnorer(dropboxDir, false, NewTestLogger(t), ctx, &wg, main.NewEventBus(), fsnotify.Options{})
+	requireNoError(t, err)
+	defer PrintDropboxIgnorerStatsIfTestFailed(t, i)
+	require.True(t, i.IgnoredPathsSet().Has(removedDir))
+
+	pauseChanges := make(chan bool, 10)
+	i.AddPauseEventListener(func(paused bool) {
+		pauseChanges <- paused
+	})
+	ft := NewFileTester(t, i)
+
+	i.Pause()
+	require.True(t, readChanTimeout(t, pauseChanges, time.Second, "pause"))
+	require.True(t, i.Paused())
+
+	newDir := filepath.Join(dropboxDir, "new", "node_modules")
+	requireNoError(t, os.MkdirAll(newDir, os.ModePerm))
+	requireNoError(t, os.RemoveAll(filepath.Dir(removedDir)))
+	// give the watcher time to deliver the events, they must only be recorded
+	time.Sleep(time.Second)
+	require.False(t, i.IgnoredPathsSet().Has(newDir))
+	require.True(t, i.IgnoredPathsSet().Has(removedDir))
+	hasFlag, err := main.HasDropboxIgnoreFlag(newDir)
+	requireNoError(t, err)
+	require.False(t, hasFlag)
+
+	i.Resume()
+	require.False(t, readChanTimeout(t, pauseChanges, time.Second, "resume"))
+	ft.WaitForFileAddEvents([]string{newDir})
+	ft.WaitForFileRemoveEvents([]string{removedDir})
+	hasFlag, err = main.HasDropboxIgnoreFlag(newDir)
+	requireNoError(t, err)
+	require.True(t, hasFlag)
+
+	ctxCancel()
+	wg.Wait()
+}
+
+func TestDropboxIgnorerStartPaused(t *testing.T) {
+	CheckTestParallel(t)
+
+	tmpTestDir := t.TempDir()
+	dropboxDir := filepath.Join(tmpTestDir, "dropbox")
+	requireMkdir(t, dropboxDir)
+	defer PrintFileTreeIfTestFailed(t, dropboxDir)
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer ctxCancel()
+
+	createDropboxignore(t, filepath.Join(dropboxDir, main.DropboxIgnoreFilename), "node_modules")
+	nodeModulesDir := filepath.Join(dropboxDir, "node_modules")
+	requireMkdir(t, nodeModulesDir)
+
+	var wg sync.WaitGroup
+	i, err := main.NewPausedDropboxIgnorer(dropboxDir, false, NewTestLogger(t), ctx, &wg, main.NewEventBus(), fsnotify.Options{})
+	requireNoError(t, err)
+	defer PrintDropboxIgnorerStatsIfTestFailed(t, i)
+	require.True(t, i.Paused())
+	require.Equal(t, 0, i.IgnoredPathsSet().Len())
+
+	ft := NewFileTester(t, i)
+	i.Resume()
+	ft.WaitForFileAddEvents([]string{nodeModulesDir})
+
+	ctxCancel()
+	wg.Wait()
+}
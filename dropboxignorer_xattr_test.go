@@ -0,0 +1,73 @@
+//go:build !windows
+
+package main_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	main "github.com/anton15x/dropbox_ignore_service"
+	"github.com/anton15x/dropbox_ignore_service/src/fsnotify"
+	"github.com/pkg/xattr"
+	"github.com/stretchr/testify/require"
+)
+
+func setDropboxSyncAttributes(t *testing.T, path string) {
+	requireNoError(t, xattr.Set(path, "user.com.dropbox.attrs", []byte{0x0a}))
+}
+
+func TestHasDropboxSyncAttributes(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "synced")
+	requireMkdir(t, dir)
+
+	synced, err := main.HasDropboxSyncAttributes(dir)
+	requireNoError(t, err)
+	require.False(t, synced)
+
+	setDropboxSyncAttributes(t, dir)
+	synced, err = main.HasDropboxSyncAttributes(dir)
+	requireNoError(t, err)
+	require.True(t, synced)
+}
+
+func TestDropboxIgnorerAlreadyUploaded(t *testing.T) {
+	CheckTestParallel(t)
+
+	tmpTestDir := t.TempDir()
+	dropboxDir := filepath.Join(tmpTestDir, "dropbox")
+	requireMkdir(t, dropboxDir)
+	defer PrintFileTreeIfTestFailed(t, dropboxDir)
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer ctxCancel()
+
+	createDropboxignore(t, filepath.Join(dropboxDir, main.DropboxIgnoreFilename), "node_modules")
+	uploadedDir := filepath.Join(dropboxDir, "uploaded", "node_modules")
+	requireNoError(t, os.MkdirAll(uploadedDir, os.ModePerm))
+	setDropboxSyncAttributes(t, uploadedDir)
+
+	var wg sync.WaitGroup
+	i, err := main.NewDropboxIgnorer(dropboxDir, false, NewTestLogger(t), ctx, &wg, main.NewEventBus(), fsnotify.Options{})
+	requireNoError(t, err)
+	alreadyUploadedSet := i.AlreadyUploadedSet()
+	defer PrintDropboxIgnorerStatsIfTestFailed(t, i)
+
+	// flagged anyway, but reported
+	checkIsIgnored(t, uploadedDir, true, "already uploaded dir")
+	require.Equal(t, []string{uploadedDir}, alreadyUploadedSet.Values())
+
+	ft := NewFileTester(t, i)
+	ft.Mkdir(filepath.Join(dropboxDir, "node_modules"), true)
+	require.Equal(t, []string{uploadedDir}, alreadyUploadedSet.Values())
+
+	requireNoError(t, os.RemoveAll(filepath.Join(dropboxDir, "uploaded")))
+	require.Eventually(t, func() bool {
+		return alreadyUploadedSet.Len() == 0
+	}, 20*time.Second, 10*time.Millisecond)
+
+	ctxCancel()
+	wg.Wait()
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type IgnorerEventType int
+
+const (
+	EventPathIgnored IgnorerEventType = iota
+	EventPathUnignored
+	EventIgnoreFileAdded
+	EventIgnoreFileRemoved
+	EventIgnoreFileInvalid
+	EventScanStarted
+	EventScanProgress
+	EventScanFinished
+	EventWatcherError
+)
+
+func (t IgnorerEventType) String() string {
+	switch t {
+	case EventPathIgnored:
+		return "PathIgnored"
+	case EventPathUnignored:
+		return "PathUnignored"
+	case EventIgnoreFileAdded:
+		return "IgnoreFileAdded"
+	case EventIgnoreFileRemoved:
+		return "IgnoreFileRemoved"
+	case EventIgnoreFileInvalid:
+		return "IgnoreFileInvalid"
+	case EventScanStarted:
+		return "ScanStarted"
+	case EventScanProgress:
+		return "ScanProgress"
+	case EventScanFinished:
+		return "ScanFinished"
+	case EventWatcherError:
+		return "WatcherError"
+	default:
+		return fmt.Sprintf("IgnorerEventType(%d)", int(t))
+	}
+}
+
+// EventCause tells why the dropbox ignorer did something
+type EventCause string
+
+const (
+	CauseInitialScan     EventCause = "initial scan"
+	CauseWatcherEvent    EventCause = "file watcher event"
+	CauseOverflowRescan  EventCause = "rescan after lost events"
+	CauseWatcherRestart  EventCause = "rescan after file watcher restart"
+	CauseFlagStripped    EventCause = "flag stripped externally"
+	CauseIgnoreFileEdit  EventCause = "ignore file changed"
+	CausePathRemoved     EventCause = "path removed"
+	CauseWatcherFailure  EventCause = "file watcher failure"
+	CauseUnignoreRequest EventCause = "unignore request"
+	CauseResume          EventCause = "resume"
+	CauseReconcile       EventCause = "reconcile"
+	CauseRescanRequest   EventCause = "rescan request"
+)
+
+type IgnorerEvent struct {
+	Type IgnorerEventType
+	Time time.Time
+	// Root is the dropbox folder of the dropbox ignorer, that published the event
+	Root  string
+	Path  string
+	Cause EventCause
+
+	// IgnoreFile and Rule are the provenance of PathIgnored events
+	IgnoreFile string
+	Rule       string
+	// TryRun is set, if the flag would have been set
+	TryRun bool
+	// AlreadyFlagged is set, if the path already had the flag
+	AlreadyFlagged bool
+
+	// Count is the number of walked paths of scan events
+	Count int
+	Err   error
+}
+
+func (e IgnorerEvent) String() string {
+	s := fmt.Sprintf("%s %s", e.Type, e.Path)
+	if e.Cause != "" {
+		s += fmt.Sprintf(" (%s)", e.Cause)
+	}
+	if e.Err != nil {
+		s += ": " + e.Err.Error()
+	}
+	return s
+}
+
+// EventBus fans out the events of the dropbox ignorers.
+// Publish never blocks, events are dropped for subscribers with a full buffer.
+type EventBus struct {
+	m           sync.Mutex
+	subscribers []*EventSubscription
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{}
+}
+
+type EventSubscription struct {
+	C <-chan IgnorerEvent
+
+	c       chan IgnorerEvent
+	bus     *EventBus
+	dropped atomic.Int64
+}
+
+// Subscribe returns a subscription, that buffers up to bufferSize events
+func (b *EventBus) Subscribe(bufferSize int) *EventSubscription {
+	c := make(chan IgnorerEvent, bufferSize)
+	s := &EventSubscription{
+		C:   c,
+		c:   c,
+		bus: b,
+	}
+
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	b.subscribers = append(b.subscribers, s)
+	return s
+}
+
+func (b *EventBus) Publish(e IgnorerEvent) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	for _, s := range b.subscribers {
+		select {
+		case s.c <- e:
+		default:
+			s.dropped.Add(1)
+		}
+	}
+}
+
+// Unsubscribe closes C, buffered events can still be read
+func (s *EventSubscription) Unsubscribe() {
+	s.bus.m.Lock()
+	defer s.bus.m.Unlock()
+
+	for i, subscriber := range s.bus.subscribers {
+		if subscriber == s {
+			s.bus.subscribers = append(s.bus.subscribers[:i:i], s.bus.subscribers[i+1:]...)
+			close(s.c)
+			return
+		}
+	}
+}
+
+// Dropped returns the number of events, that did not fit into the buffer
+func (s *EventSubscription) Dropped() int64 {
+	return s.dropped.Load()
+}
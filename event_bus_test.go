@@ -0,0 +1,41 @@
+package main_test
+
+import (
+	"errors"
+	"testing"
+
+	main "github.com/anton15x/dropbox_ignore_service"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventBus(t *testing.T) {
+	bus := main.NewEventBus()
+	a := bus.Subscribe(10)
+	b := bus.Subscribe(1)
+
+	bus.Publish(main.IgnorerEvent{Type: main.EventPathIgnored, Path: "/a"})
+	bus.Publish(main.IgnorerEvent{Type: main.EventPathUnignored, Path: "/a"})
+
+	// every subscriber gets the events in order
+	e := <-a.C
+	require.Equal(t, main.EventPathIgnored, e.Type)
+	require.False(t, e.Time.IsZero())
+	e = <-a.C
+	require.Equal(t, main.EventPathUnignored, e.Type)
+	require.Equal(t, int64(0), a.Dropped())
+
+	// the full buffer does not block the publisher
+	e = <-b.C
+	require.Equal(t, main.EventPathIgnored, e.Type)
+	require.Equal(t, int64(1), b.Dropped())
+
+	b.Unsubscribe()
+	_, ok := <-b.C
+	require.False(t, ok)
+	b.Unsubscribe()
+
+	bus.Publish(main.IgnorerEvent{Type: main.EventWatcherError, Err: errors.New("test")})
+	e = <-a.C
+	require.Equal(t, main.EventWatcherError, e.Type)
+	require.Equal(t, "WatcherError : test", e.String())
+}
@@ -0,0 +1,50 @@
+package main
+
+import "errors"
+
+// exit codes of the program
+const (
+	ExitOK = 0
+	// ExitError is used for errors while running
+	ExitError = 1
+	// ExitUsage is used for invalid flags
+	ExitUsage = 2
+	// ExitNoDropboxFolder is used if the dropbox folders could not be found
+	ExitNoDropboxFolder = 3
+	// ExitAlreadyRunning is used if another instance is running and could not be reached
+	ExitAlreadyRunning = 4
+)
+
+type exitCodeError struct {
+	code int
+	err  error
+}
+
+func (e *exitCodeError) Error() string {
+	return e.err.Error()
+}
+func (e *exitCodeError) Unwrap() error {
+	return e.err
+}
+
+func withExitCode(code int, err error) error {
+	return &exitCodeError{
+		code: code,
+		err:  err,
+	}
+}
+
+// ExitCode returns the exit code for err, ExitError if err has none
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	var exitErr *exitCodeError
+	if errors.As(err, &exitErr) {
+		return exitErr.code
+	}
+	if errors.Is(err, ErrNoDropboxInfoFile) {
+		return ExitNoDropboxFolder
+	}
+	return ExitError
+}
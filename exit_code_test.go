@@ -0,0 +1,18 @@
+package main_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	main "github.com/anton15x/dropbox_ignore_service"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExitCode(t *testing.T) {
+	CheckTestParallel(t)
+
+	require.Equal(t, main.ExitOK, main.ExitCode(nil))
+	require.Equal(t, main.ExitError, main.ExitCode(errors.New("test")))
+	require.Equal(t, main.ExitNoDropboxFolder, main.ExitCode(fmt.Errorf("wrapped: %w", main.ErrNoDropboxInfoFile)))
+}
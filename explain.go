@@ -0,0 +1,74 @@
+package main
+
+import (
+	"path/filepath"
+)
+
+// PathExplanation tells why a path is ignored or not
+type PathExplanation struct {
+	Root string `json:"root"`
+	Path string `json:"path"`
+	// Ignored is true, if the ignore rules ignore Path or a directory containing it
+	Ignored bool `json:"ignored"`
+	// IgnoreFile and Rule ignore Path or IgnoredParent
+	IgnoreFile string `json:"ignoreFile,omitempty"`
+	Rule       string `json:"rule,omitempty"`
+	// IgnoredParent is the ignored directory, that contains Path
+	IgnoredParent   string `json:"ignoredParent,omitempty"`
+	Flagged         bool   `json:"flagged"`
+	AlreadyUploaded bool   `json:"alreadyUploaded"`
+}
+
+type explainRequest struct {
+	path        string
+	explanation chan PathExplanation
+}
+
+// Explain returns why path is ignored or not.
+// The ignore rules are read by the event loop, it waits until the event loop is running.
+func (i *DropboxIgnorer) Explain(path string) (PathExplanation, error) {
+	r := explainRequest{
+		path:        path,
+		explanation: make(chan PathExplanation, 1),
+	}
+	select {
+	case <-i.ctx.Done():
+		return PathExplanation{}, i.ctx.Err()
+	case i.explainRequests <- r:
+	}
+	select {
+	case <-i.ctx.Done():
+		return PathExplanation{}, i.ctx.Err()
+	case e := <-r.explanation:
+		return e, nil
+	}
+}
+
+func (i *DropboxIgnorer) explain(path string) PathExplanation {
+	e := PathExplanation{
+		Root:            i.dropboxPath,
+		Path:            path,
+		AlreadyUploaded: i.alreadyUploadedSet.Has(path),
+	}
+	// a missing path has no flag
+	e.Flagged, _ = HasDropboxIgnoreFlag(path)
+
+	ignoredPath := path
+	for dir := path; dir != i.dropboxPath; {
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+		if dir == i.dropboxPath {
+			break
+		}
+		if i.ShouldPathGetIgnored(dir) {
+			e.IgnoredParent = dir
+			ignoredPath = dir
+			break
+		}
+	}
+	e.IgnoreFile, e.Rule, e.Ignored = i.matchingIgnoreRule(ignoredPath)
+	return e
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+)
+
+// ScannedPath is a path found by ScanFlaggedPaths
+type ScannedPath struct {
+	// Root is the scanned root, that contains Path
+	Root    string `json:"root"`
+	Path    string `json:"path"`
+	IsDir   bool   `json:"isDir"`
+	Flagged bool   `json:"flagged"`
+}
+
+type FlaggedScanProgress struct {
+	Root string
+	// Path is the last scanned path
+	Path    string
+	Walked  int
+	Flagged int
+}
+
+type FlaggedScanOptions struct {
+	// Workers is the number of directories read in parallel (default: runtime.NumCPU())
+	Workers int
+	// Skip skips a path and its content (default: SkipDropboxCache)
+	Skip func(root, path string) bool
+	// AllPaths passes the paths without ignore flag to OnPath as well
+	AllPaths bool
+	// OnPath receives the flagged paths.
+	// A directory is passed before its content, the calls are serialized.
+	OnPath func(ScannedPath)
+	// SkipContent reports a directory, but does not read its content (default: none).
+	// It is called after OnPath, the calls are serialized.
+	SkipContent func(ScannedPath) bool
+	// OnProgress is called every scanProgressInterval paths and after the scan, the calls are serialized
+	OnProgress func(FlaggedScanProgress)
+}
+
+func (o *FlaggedScanOptions) setDefaults() {
+	if o.Workers <= 0 {
+		o.Workers = runtime.NumCPU()
+	}
+	if o.Skip == nil {
+		o.Skip = SkipDropboxCache
+	}
+}
+
+// SkipDropboxCache skips the cache folder of the dropbox client
+func SkipDropboxCache(root, path string) bool {
+	return path == filepath.Join(root, ".dropbox.cache")
+}
+
+// ScanFlaggedPaths finds the paths with the ignore flag inside roots.
+// The directories are read in parallel, the scan stops at the first error or if ctx is done.
+func ScanFlaggedPaths(ctx context.Context, roots []string, opts FlaggedScanOptions) error {
+	opts.setDefaults()
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	s := &flaggedScanner{
+		ctx:    ctx,
+		cancel: cancel,
+		opts:   opts,
+	}
+	s.cond = sync.NewCond(&s.m)
+
+	for _, root := range roots {
+		if opts.Skip(root, root) {
+			continue
+		}
+		info, err := os.Lstat(root)
+		if err != nil {
+			return fmt.Errorf("error scanning %s: %w", root, err)
+		}
+		s.scanPath(root, root, info.IsDir(), info.Mode().IsRegular())
+	}
+
+	var wg sync.WaitGroup
+	for n := 0; n < opts.Workers; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.work()
+		}()
+	}
+	wg.Wait()
+
+	if opts.OnProgress != nil {
+		opts.OnProgress(s.progress)
+	}
+	return context.Cause(ctx)
+}
+
+type flaggedScanner struct {
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	opts   FlaggedScanOptions
+
+	// m guards the queue of directories, pending counts the queued directories and the ones being read
+	m       sync.Mutex
+	cond    *sync.Cond
+	queue   []ScannedPath
+	pending int
+
+	// callbackMutex serializes the callbacks and guards progress
+	callbackMutex sync.Mutex
+	progress      FlaggedScanProgress
+}
+
+func (s *flaggedScanner) work() {
+	for {
+		s.m.Lock()
+		for len(s.queue) == 0 && s.pending > 0 {
+			s.cond.Wait()
+		}
+		if len(s.queue) == 0 {
+			s.m.Unlock()
+			return
+		}
+		// last in first out keeps the queue small
+		dir := s.queue[len(s.queue)-1]
+		s.queue = s.queue[:len(s.queue)-1]
+		s.m.Unlock()
+
+		s.readDir(dir)
+
+		s.m.Lock()
+		s.pending--
+		if s.pending == 0 {
+			s.cond.Broadcast()
+		}
+		s.m.Unlock()
+	}
+}
+
+func (s *flaggedScanner) readDir(dir ScannedPath) {
+	if s.ctx.Err() != nil {
+		return
+	}
+	entries, err := os.ReadDir(dir.Path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			s.cancel(fmt.Errorf("error scanning %s: %w", dir.Path, err))
+		}
+		return
+	}
+	for _, entry := range entries {
+		if s.ctx.Err() != nil {
+			return
+		}
+		path := filepath.Join(dir.Path, entry.Name())
+		if s.opts.Skip(dir.Root, path) {
+			continue
+		}
+		s.scanPath(dir.Root, path, entry.IsDir(), entry.Type().IsRegular())
+	}
+}
+
+// scanPath reports path and queues it, if it is a directory
+func (s *flaggedScanner) scanPath(root, path string, isDir, isRegular bool) {
+	if !isDir && !isRegular {
+		// only files/directories may have the ignore flag, but not symlinks
+		return
+	}
+
+	flagged, err := HasDropboxIgnoreFlag(path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			s.cancel(fmt.Errorf("error checking ignore flag of %s: %w", path, err))
+		}
+		return
+	}
+	p := ScannedPath{
+		Root:    root,
+		Path:    path,
+		IsDir:   isDir,
+		Flagged: flagged,
+	}
+
+	s.callbackMutex.Lock()
+	s.progress.Root = root
+	s.progress.Path = path
+	s.progress.Walked++
+	if flagged {
+		s.progress.Flagged++
+	}
+	if s.opts.OnPath != nil && (flagged || s.opts.AllPaths) {
+		s.opts.OnPath(p)
+	}
+	if s.opts.OnProgress != nil && s.progress.Walked%scanProgressInterval == 0 {
+		s.opts.OnProgress(s.progress)
+	}
+	skipContent := isDir && s.opts.SkipContent != nil && s.opts.SkipContent(p)
+	s.callbackMutex.Unlock()
+
+	if isDir && !skipContent {
+		s.m.Lock()
+		s.queue = append(s.queue, p)
+		s.pending++
+		s.cond.Signal()
+		s.m.Unlock()
+	}
+}
@@ -0,0 +1,97 @@
+package main_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	main "github.com/anton15x/dropbox_ignore_service"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScanFlaggedPaths(t *testing.T) {
+	CheckTestParallel(t)
+
+	tmpTestDir := t.TempDir()
+	rootA := filepath.Join(tmpTestDir, "a")
+	rootB := filepath.Join(tmpTestDir, "b")
+	var expected []string
+	for _, root := range []string{rootA, rootB} {
+		for n := 0; n < 20; n++ {
+			dir := filepath.Join(root, fmt.Sprintf("dir%d", n), "sub")
+			requireNoError(t, os.MkdirAll(dir, os.ModePerm))
+			file := filepath.Join(dir, "file")
+			requireNoError(t, os.WriteFile(file, nil, os.ModePerm))
+			if n%3 == 0 {
+				requireNoError(t, main.SetDropboxIgnoreFlag(dir))
+				expected = append(expected, dir)
+			}
+			if n%5 == 0 {
+				requireNoError(t, main.SetDropboxIgnoreFlag(file))
+				expected = append(expected, file)
+			}
+		}
+		cacheDir := filepath.Join(root, ".dropbox.cache")
+		requireMkdir(t, cacheDir)
+		requireNoError(t, main.SetDropboxIgnoreFlag(cacheDir))
+	}
+	slices.Sort(expected)
+
+	var found []string
+	var progress main.FlaggedScanProgress
+	err := main.ScanFlaggedPaths(context.Background(), []string{rootA, rootB}, main.FlaggedScanOptions{
+		Workers: 4,
+		OnPath: func(p main.ScannedPath) {
+			require.True(t, p.Flagged)
+			require.True(t, strings.HasPrefix(p.Path, p.Root+string(filepath.Separator)), p.Path)
+			found = append(found, p.Path)
+		},
+		OnProgress: func(p main.FlaggedScanProgress) {
+			progress = p
+		},
+	})
+	requireNoError(t, err)
+	slices.Sort(found)
+	require.Equal(t, expected, found)
+	// roots, 20 dirs with a sub dir and a file each
+	require.Equal(t, 2*(1+3*20), progress.Walked)
+	require.Equal(t, len(expected), progress.Flagged)
+
+	// a directory is passed before its content
+	seen := map[string]bool{}
+	err = main.ScanFlaggedPaths(context.Background(), []string{rootA}, main.FlaggedScanOptions{
+		AllPaths: true,
+		OnPath: func(p main.ScannedPath) {
+			if p.Path != rootA {
+				require.True(t, seen[filepath.Dir(p.Path)], p.Path)
+			}
+			seen[p.Path] = true
+		},
+	})
+	requireNoError(t, err)
+	require.Len(t, seen, 1+3*20)
+
+	// the content of the skipped directories is not read, the directories are reported
+	clear(seen)
+	err = main.ScanFlaggedPaths(context.Background(), []string{rootA}, main.FlaggedScanOptions{
+		AllPaths: true,
+		OnPath: func(p main.ScannedPath) {
+			seen[p.Path] = true
+		},
+		SkipContent: func(p main.ScannedPath) bool {
+			return filepath.Base(p.Path) == "sub"
+		},
+	})
+	requireNoError(t, err)
+	require.Len(t, seen, 1+2*20)
+	require.True(t, seen[filepath.Join(rootA, "dir0", "sub")])
+
+	ctx, ctxCancel := context.WithCancel(context.Background())
+	ctxCancel()
+	err = main.ScanFlaggedPaths(ctx, []string{rootA, rootB}, main.FlaggedScanOptions{})
+	require.ErrorIs(t, err, context.Canceled)
+}
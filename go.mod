@@ -11,6 +11,7 @@ require (
 	github.com/rjeczalik/notify v0.9.3
 	github.com/spiretechnology/go-autostart/v2 v2.0.0
 	github.com/stretchr/testify v1.8.4
+	golang.org/x/sys v0.13.0
 )
 
 require (
@@ -34,7 +35,6 @@ require (
 	golang.org/x/image v0.11.0 // indirect
 	golang.org/x/mobile v0.0.0-20230531173138-3c911d8e3eda // indirect
 	golang.org/x/net v0.17.0 // indirect
-	golang.org/x/sys v0.13.0 // indirect
 	golang.org/x/text v0.13.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 	honnef.co/go/js/dom v0.0.0-20210725211120-f030747120f2 // indirect
@@ -1,16 +1,19 @@
+//go:build !nogui
+
 package main
 
 import (
 	"context"
 	"errors"
 	"fmt"
-	"io/fs"
-	"log"
+	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"fyne.io/fyne/v2"
@@ -44,8 +47,12 @@ func appNameToUserDisplay(a fyne.App) string {
 	return ret
 }
 
-func ShowGUI(ctx context.Context, dropboxIgnorers []*DropboxIgnorer, hideGUI bool, ignoredPathsSet *SortedStringSet, ignoreFilesSet *SortedStringSet, logStringSlice *logStringSliceStruct) error {
+func ShowGUI(ctx context.Context, manager *RootManager, control *ControlService, config *ConfigStore, hideGUI bool, logStore *LogStore) error {
 	guiCtx := ctx
+	logger := componentLogger(slog.Default(), LogComponentGUI)
+	ignoredPathsSet := manager.IgnoredPathsSet()
+	ignoreFilesSet := manager.IgnoreFilesSet()
+	alreadyUploadedSet := manager.AlreadyUploadedSet()
 
 	// FyneApp.toml has id and icon set => fyne build adds metadata for us
 	// do not use go build, instead use:
@@ -56,8 +63,13 @@ func ShowGUI(ctx context.Context, dropboxIgnorers []*DropboxIgnorer, hideGUI boo
 	w := a.NewWindow(appNameToUserDisplay(a))
 	w.Resize(fyne.NewSize(1200, 800))
 
+	// homeSelectedRoot is empty to show the ignored paths of all dropbox folders
+	homeSelectedRoot := ""
 	ignoredPathsSetList := widget.NewList(
 		func() int {
+			if set := ignoredPathsSet.RootSet(homeSelectedRoot); set != nil {
+				return set.Len()
+			}
 			return ignoredPathsSet.Len()
 		},
 		func() fyne.CanvasObject {
@@ -66,6 +78,9 @@ func ShowGUI(ctx context.Context, dropboxIgnorers []*DropboxIgnorer, hideGUI boo
 		func(i widget.ListItemID, o fyne.CanvasObject) {
 			// multithreading
 			name := ignoredPathsSet.GetOrEmptyString(i)
+			if set := ignoredPathsSet.RootSet(homeSelectedRoot); set != nil {
+				name = set.GetOrEmptyString(i)
+			}
 
 			label := o.(*widget.Label)
 			label.SetText(name)
@@ -73,15 +88,152 @@ func ShowGUI(ctx context.Context, dropboxIgnorers []*DropboxIgnorer, hideGUI boo
 	)
 	homeTopLabel := widget.NewLabel("")
 	updateHomeTopLabel := func() {
-		homeTopLabel.SetText(fmt.Sprintf("Ignoring %d elements", ignoredPathsSet.Len()))
+		homeTopLabel.SetText(fmt.Sprintf("Ignoring %d elements", ignoredPathsSet.Len()) + rootCountsText(ignoredPathsSet))
 	}
 	ignoredPathsSet.AddChangeEventListener(Debounce(func() {
 		updateHomeTopLabel()
 		ignoredPathsSetList.Refresh()
 	}, time.Second/60))
 	updateHomeTopLabel()
+	const allRootsOption = "All dropbox folders"
+	updatePauseState := func() {}
+	homeRootSelect := widget.NewSelect(append([]string{allRootsOption}, ignoredPathsSet.Roots()...), func(value string) {
+		homeSelectedRoot = value
+		if value == allRootsOption {
+			homeSelectedRoot = ""
+		}
+		ignoredPathsSetList.Refresh()
+		updatePauseState()
+	})
+	homeRootSelect.SetSelected(allRootsOption)
+	updateHomeRootSelect := func() {
+		roots := ignoredPathsSet.Roots()
+		homeRootSelect.Options = append([]string{allRootsOption}, roots...)
+		if homeSelectedRoot != "" && !slices.Contains(roots, homeSelectedRoot) {
+			homeRootSelect.SetSelected(allRootsOption)
+		}
+		if len(roots) < 2 {
+			homeRootSelect.Hide()
+		} else {
+			homeRootSelect.Show()
+		}
+		homeRootSelect.Refresh()
+	}
+	updateHomeRootSelect()
+	overflowRescanLabel := widget.NewLabel("")
+	overflowRescanLabel.Hide()
+	updateOverflowRescanLabel := func() {
+		var count int64
+		for _, d := range manager.Ignorers() {
+			count += d.OverflowRescanCount()
+		}
+		if count == 0 {
+			overflowRescanLabel.Hide()
+			return
+		}
+		overflowRescanLabel.SetText(fmt.Sprintf("The file watcher lost events, rescanned %d times (last: %s)", count, time.Now().Format(time.DateTime)))
+		overflowRescanLabel.Show()
+	}
+	flagsStrippedLabel := widget.NewLabel("")
+	flagsStrippedLabel.Hide()
+	updateFlagsStrippedLabel := func(path string) {
+		var count int64
+		for _, d := range manager.Ignorers() {
+			count += d.FlagsStrippedCount()
+		}
+		flagsStrippedLabel.SetText(fmt.Sprintf("Other programs removed %d ignore flags, they got set again (last: %s)", count, path))
+		flagsStrippedLabel.Show()
+	}
+	watcherStateText := func() string {
+		// the worst state of all dropbox folders
+		state := WatcherStateHealthy
+		var notHealthyPaths []string
+		for _, d := range manager.Ignorers() {
+			dState := d.WatcherState()
+			if dState != WatcherStateHealthy {
+				notHealthyPaths = append(notHealthyPaths, d.DropboxPath())
+			}
+			state = max(state, dState)
+		}
+		if len(notHealthyPaths) == 0 {
+			return "File watcher: " + state.String()
+		}
+		return fmt.Sprintf("File watcher: %s (%s)", state.String(), strings.Join(notHealthyPaths, ", "))
+	}
+	watcherStateLabel := widget.NewLabel(watcherStateText())
+	// pauseTargets are the dropbox ignorers of the selected dropbox folder, or all of them
+	pauseTargets := func() []*DropboxIgnorer {
+		ignorers := manager.Ignorers()
+		if homeSelectedRoot == "" {
+			return ignorers
+		}
+		return slices.DeleteFunc(ignorers, func(d *DropboxIgnorer) bool {
+			return d.DropboxPath() != homeSelectedRoot
+		})
+	}
+	anyRunning := func(ignorers []*DropboxIgnorer) bool {
+		return slices.ContainsFunc(ignorers, func(d *DropboxIgnorer) bool {
+			return !d.Paused()
+		})
+	}
+	setPaused := func(ignorers []*DropboxIgnorer, paused bool) {
+		for _, d := range ignorers {
+			if paused {
+				d.Pause()
+			} else {
+				d.Resume()
+			}
+		}
+	}
+	pauseButton := widget.NewButton("Pause", func() {
+		ignorers := pauseTargets()
+		setPaused(ignorers, anyRunning(ignorers))
+	})
+	pausedLabel := widget.NewLabel("")
+	pausedLabel.Hide()
+	driftLabel := widget.NewLabel("")
+	driftLabel.Hide()
+	updateDriftLabel := func() {
+		var total DriftReport
+		found := false
+		for _, d := range manager.Ignorers() {
+			report := d.LastDriftReport()
+			if report == nil {
+				continue
+			}
+			found = true
+			total.MissingFlags = append(total.MissingFlags, report.MissingFlags...)
+			total.UnexpectedFlags = append(total.UnexpectedFlags, report.UnexpectedFlags...)
+			total.NestedFlags = append(total.NestedFlags, report.NestedFlags...)
+			total.Fixed = append(total.Fixed, report.Fixed...)
+			if report.Finished.After(total.Finished) {
+				total.Finished = report.Finished
+			}
+			total.Err = errors.Join(total.Err, report.Err)
+		}
+		if !found {
+			driftLabel.Hide()
+			return
+		}
+		driftLabel.SetText(fmt.Sprintf("Drift: %s (last reconcile: %s)", total, total.Finished.Format(time.DateTime)))
+		driftLabel.Show()
+	}
+	var reconcileButton *widget.Button
+	reconcileButton = widget.NewButton("Reconcile now", func() {
+		reconcileButton.Disable()
+		ignorers := pauseTargets()
+		go func() {
+			defer reconcileButton.Enable()
+			for _, d := range ignorers {
+				_, err := d.Reconcile(manager.ReconcileFix())
+				if err != nil {
+					return
+				}
+			}
+		}()
+	})
 	homeContent := container.NewBorder(
-		homeTopLabel,
+		container.NewVBox(homeTopLabel, container.NewHBox(homeRootSelect, pauseButton, reconcileButton), watcherStateLabel, pausedLabel, driftLabel, overflowRescanLabel, flagsStrippedLabel),
 		nil, nil, nil,
 		ignoredPathsSetList,
 	)
@@ -138,8 +290,8 @@ func ShowGUI(ctx context.Context, dropboxIgnorers []*DropboxIgnorer, hideGUI boo
 		ignoredFilesListContent.Refresh()
 	}, time.Second/60)
 
-	ignoredFilesProgressBar := widget.NewProgressBar()
-	ignoredFilesProgressBar.Max = float64(len(dropboxIgnorers))
+	// the dropbox folders are scanned in parallel, the progress is unknown
+	ignoredFilesProgressBar := widget.NewProgressBarInfinite()
 	ignoredFilesProgressCurrentDropboxPath := widget.NewLabel("")
 	ignoredFilesProgressCurrentPath := widget.NewLabel("")
 	ignoredFilesProgress := container.NewVBox(
@@ -152,7 +304,6 @@ func ShowGUI(ctx context.Context, dropboxIgnorers []*DropboxIgnorer, hideGUI boo
 	})
 	ignoredPathsSet.AddAddEventListener(func(s string) {
 		ignoredFileNames.Add(s)
-		a.SendNotification(fyne.NewNotification("DropboxIgnoreFlag added", s))
 	})
 	ignoredPathsSet.AddRemoveEventListener(func(s string) {
 		ignoredFileNames.Remove(s)
@@ -167,58 +318,32 @@ func ShowGUI(ctx context.Context, dropboxIgnorers []*DropboxIgnorer, hideGUI boo
 		ignoredFilesProgressCurrentPath.Refresh()
 	}, time.Second/60)
 	var ignoredFilesCtxStop context.CancelFunc
-	var ignoredFilesCtxStopError = errors.New("ignoredFilesCtxStopped")
 	reScanIgnoredFiles := func() error {
 		var ignoredFilesCtx context.Context
 		ignoredFilesCtx, ignoredFilesCtxStop = context.WithCancel(guiCtx)
 
-		ignoredFilesProgressBar.SetValue(0)
 		ignoredFilesProgressCurrentDropboxPath.SetText("")
 		ignoredFilesProgress.Show()
+		defer ignoredFilesProgress.Hide()
 		ignoredFileNames.RemoveAll()
 
-		for i, dropboxIgnorer := range dropboxIgnorers {
-			ignoredFilesProgressCurrentDropboxPath.SetText(dropboxIgnorer.dropboxPath)
-
-			err := filepath.WalkDir(dropboxIgnorer.dropboxPath, func(path string, info fs.DirEntry, err error) error {
-				if err != nil {
-					return err
-				}
-				if err = ignoredFilesCtx.Err(); err != nil {
-					return ignoredFilesCtxStopError
-				}
-
-				if !info.IsDir() {
-					statInfo, err := info.Info()
-					if err != nil {
-						return err
-					}
-					if !statInfo.Mode().IsRegular() {
-						// only files/directories may have the ignore flag, but not symlinks
-						return nil
-					}
+		var roots []string
+		for _, dropboxIgnorer := range manager.Ignorers() {
+			roots = append(roots, dropboxIgnorer.DropboxPath())
+		}
+		return ScanFlaggedPaths(ignoredFilesCtx, roots, FlaggedScanOptions{
+			Workers: config.Config().Workers,
+			OnPath: func(p ScannedPath) {
+				ignoredFileNames.Add(p.Path)
+			},
+			OnProgress: func(p FlaggedScanProgress) {
+				if ignoredFilesProgressCurrentDropboxPath.Text != p.Root {
+					ignoredFilesProgressCurrentDropboxPath.SetText(p.Root)
 				}
-
-				ignoredFilesProgressCurrentPath.Text = path
+				ignoredFilesProgressCurrentPath.Text = p.Path
 				ignoredFilesProgressCurrentPathRefreshDebounced()
-				isIgnored, err := HasDropboxIgnoreFlag(path)
-				if err != nil {
-					return err
-				}
-				if isIgnored && !ignoredFileNames.Has(path) && !strings.HasPrefix(path, filepath.Join(dropboxIgnorer.dropboxPath, ".dropbox.cache")) {
-					ignoredFileNames.Add(path)
-				}
-
-				return nil
-			})
-			if err != nil {
-				return err
-			}
-			ignoredFilesProgressBar.SetValue(float64(i + 1))
-		}
-		ignoredFilesProgress.Hide()
-
-		return nil
+			},
+		})
 	}
 	ignoredFilesContentError := widget.NewLabel("")
 	ignoredFilesContentError.Hide()
@@ -230,13 +355,17 @@ func ShowGUI(ctx context.Context, dropboxIgnorers []*DropboxIgnorer, hideGUI boo
 
 	unignoreSelectedPaths := func() {
 		var errTest []string
+		ignorers := manager.Ignorers()
 		for _, name := range checkedFileNames.Values() {
-			err := RemoveDropboxIgnoreFlag(name)
+			// the ignorer must forget the path, otherwise it sets the flag again
+			err := fmt.Errorf("not inside a dropbox folder")
+			if i := ignorerOf(ignorers, name); i != nil {
+				_, err = i.Unignore([]string{name})
+			}
 			if err != nil {
-				log.Printf("error removing ignore flag from path %s: %s", name, err)
+				logger.Error("removing ignore flag failed", LogKeyPath, name, LogKeyError, err)
 				errTest = append(errTest, fmt.Sprintf("error removing ignore flag from path %s: %s", name, err))
 			} else {
-				ignoredPathsSet.Remove(name)
 				ignoredFileNames.Remove(name)
 				checkedFileNames.Remove(name)
 			}
@@ -249,7 +378,8 @@ func ShowGUI(ctx context.Context, dropboxIgnorers []*DropboxIgnorer, hideGUI boo
 	ignoredFilesRemoveIgnoreFlagButton := widget.NewButton("", func() {
 		confirmDialog := dialog.NewConfirm("Unignore", fmt.Sprintf("Are you sure to unignore %d paths?", checkedFileNames.Len()), func(b bool) {
 			if b {
-				unignoreSelectedPaths()
+				// the event loops of the ignorers may be busy with a walk
+				go unignoreSelectedPaths()
 			}
 		}, w)
 		confirmDialog.Show()
@@ -274,12 +404,29 @@ func ShowGUI(ctx context.Context, dropboxIgnorers []*DropboxIgnorer, hideGUI boo
 	)
 	ignoredFilesTab := container.NewTabItemWithIcon("Ignored Files", theme.VisibilityOffIcon(), ignoredFilesContent)
 
-	for _, d := range dropboxIgnorers {
-		ignoreFilesSet.Add(filepath.Join(d.dropboxPath, DropboxIgnoreFilename))
+	// the ignore files of the ignorers and the missing root ignore files, a click creates them
+	var ignoreFileItemsMutex sync.Mutex
+	var ignoreFileItems []string
+	updateIgnoreFileItems := func() {
+		items := slices.Clone(ignoreFilesSet.Values())
+		for _, d := range manager.Ignorers() {
+			rootIgnoreFile := filepath.Join(d.DropboxPath(), DropboxIgnoreFilename)
+			if !slices.Contains(items, rootIgnoreFile) {
+				items = append(items, rootIgnoreFile)
+			}
+		}
+		slices.Sort(items)
+
+		ignoreFileItemsMutex.Lock()
+		defer ignoreFileItemsMutex.Unlock()
+		ignoreFileItems = items
 	}
+	updateIgnoreFileItems()
 	ignoreFilesSetList := widget.NewList(
 		func() int {
-			return ignoreFilesSet.Len()
+			ignoreFileItemsMutex.Lock()
+			defer ignoreFileItemsMutex.Unlock()
+			return len(ignoreFileItems)
 		},
 		func() fyne.CanvasObject {
 			var button *widget.Button
@@ -290,12 +437,12 @@ func ShowGUI(ctx context.Context, dropboxIgnorers []*DropboxIgnorer, hideGUI boo
 				_, err := os.Stat(path)
 				if err != nil {
 					if !os.IsNotExist(err) {
-						log.Printf("Error checking if path %s exists: %s", path, err)
+						logger.Error("stat failed", LogKeyPath, path, LogKeyError, err)
 						return
 					} else {
 						err := os.WriteFile(path, []byte{}, os.ModePerm)
 						if err != nil {
-							log.Printf("Error creating dropbox ignore file %s: %s", path, err)
+							logger.Error("creating ignore file failed", LogKeyPath, path, LogKeyError, err)
 						}
 					}
 				}
@@ -335,13 +482,19 @@ func ShowGUI(ctx context.Context, dropboxIgnorers []*DropboxIgnorer, hideGUI boo
 		},
 		func(i widget.ListItemID, o fyne.CanvasObject) {
 			// multithreading
-			name := ignoreFilesSet.GetOrEmptyString(i)
+			name := ""
+			ignoreFileItemsMutex.Lock()
+			if i < len(ignoreFileItems) {
+				name = ignoreFileItems[i]
+			}
+			ignoreFileItemsMutex.Unlock()
 
 			button := o.(*widget.Button)
 			button.SetText(name)
 		},
 	)
 	ignoreFilesSet.AddChangeEventListener(Debounce(func() {
+		updateIgnoreFileItems()
 		ignoreFilesSetList.Refresh()
 	}, time.Second/60))
 	dropboxIgnoreFileContent := container.NewBorder(
@@ -350,34 +503,103 @@ func ShowGUI(ctx context.Context, dropboxIgnorers []*DropboxIgnorer, hideGUI boo
 	)
 	dropboxIgnoreFileTab := container.NewTabItemWithIcon(".dropboxignore File", theme.FileTextIcon(), dropboxIgnoreFileContent)
 
-	logStringSliceList := widget.NewList(
+	logView := NewLogView(logStore, LogFilter{Level: slog.LevelDebug})
+	// the list shows the newest record first
+	logEntryAt := func(i widget.ListItemID) (LogEntry, bool) {
+		return logView.Get(logView.Len() - i - 1)
+	}
+	logList := widget.NewList(
 		func() int {
-			return len(logStringSlice.data)
+			return logView.Len()
 		},
 		func() fyne.CanvasObject {
 			return widget.NewLabel("")
 		},
 		func(i widget.ListItemID, o fyne.CanvasObject) {
-			values := logStringSlice.data
-			i = len(values) - i - 1
 			data := ""
-			if i < len(values) {
-				data = values[i]
+			e, ok := logEntryAt(i)
+			if ok {
+				data = e.String()
 			}
 
 			label := o.(*widget.Label)
 			label.SetText(data)
 		},
 	)
-	logStringSliceListRefreshDebounced := Debounce(func() {
-		logStringSliceList.Refresh()
+	logListRefreshDebounced := Debounce(func() {
+		logView.Update()
+		logList.Refresh()
 	}, time.Second/60)
-	logStringSlice.AddChangeEventListener(func() {
-		logStringSliceListRefreshDebounced()
+	logStore.AddChangeEventListener(logListRefreshDebounced)
+
+	// the first selected record and the last one are the range of copy and export, without a selection all records of the filter
+	var logSelection []uint64
+	logSelectionLabel := widget.NewLabel("")
+	updateLogSelection := func(ids ...uint64) {
+		logSelection = ids
+		switch len(ids) {
+		case 0:
+			logSelectionLabel.SetText("Select the first and the last record to copy or export them")
+		case 1:
+			logSelectionLabel.SetText(fmt.Sprintf("Record %d selected, select the last record of the range", ids[0]))
+		default:
+			logSelectionLabel.SetText(fmt.Sprintf("Records %d to %d selected", min(ids[0], ids[1]), max(ids[0], ids[1])))
+		}
+	}
+	updateLogSelection()
+	logList.OnSelected = func(i widget.ListItemID) {
+		e, ok := logEntryAt(i)
+		if !ok {
+			return
+		}
+		if len(logSelection) == 1 {
+			updateLogSelection(logSelection[0], e.ID)
+		} else {
+			updateLogSelection(e.ID)
+		}
+	}
+	logSelectionRange := func() (uint64, uint64) {
+		switch len(logSelection) {
+		case 0:
+			first, next := logStore.Bounds()
+			return first, next
+		case 1:
+			return logSelection[0], logSelection[0]
+		default:
+			return logSelection[0], logSelection[1]
+		}
+	}
+	logClearSelectionButton := widget.NewButton("Clear selection", func() {
+		logList.UnselectAll()
+		updateLogSelection()
 	})
+
+	logLevelSelect := widget.NewSelect([]string{"DEBUG", "INFO", "WARN", "ERROR"}, nil)
+	logLevelSelect.SetSelected("DEBUG")
+	logSearchEntry := widget.NewEntry()
+	logSearchEntry.SetPlaceHolder("Search")
+	applyLogFilter := func() {
+		var level slog.Level
+		// the options are valid levels
+		_ = level.UnmarshalText([]byte(logLevelSelect.Selected))
+		logView.SetFilter(LogFilter{Level: level, Text: logSearchEntry.Text})
+		logList.UnselectAll()
+		updateLogSelection()
+		logList.Refresh()
+	}
+	logLevelSelect.OnChanged = func(string) {
+		applyLogFilter()
+	}
+	logSearchEntry.OnChanged = func(string) {
+		applyLogFilter()
+	}
+
 	var logsCopyButton *widget.Button
-	logsCopyButton = widget.NewButton("Copy Log to clipboard", func() {
-		w.Clipboard().SetContent(logStringSlice.String())
+	logsCopyButton = widget.NewButton("Copy to clipboard", func() {
+		var data strings.Builder
+		from, to := logSelectionRange()
+		_ = logView.Export(&data, from, to)
+		w.Clipboard().SetContent(data.String())
 
 		bakText := logsCopyButton.Text
 		logsCopyButton.SetText(bakText + " copied!")
@@ -387,14 +609,64 @@ func ShowGUI(ctx context.Context, dropboxIgnorers []*DropboxIgnorer, hideGUI boo
 		}()
 
 	})
+	logsExportButton := widget.NewButton("Export to file", func() {
+		from, to := logSelectionRange()
+		saveDialog := dialog.NewFileSave(func(file fyne.URIWriteCloser, err error) {
+			if err == nil && file == nil {
+				// canceled
+				return
+			}
+			if err == nil {
+				err = logView.Export(file, from, to)
+				err = errors.Join(err, file.Close())
+			}
+			if err != nil {
+				logger.Error("exporting log failed", LogKeyError, err)
+				dialog.ShowError(err, w)
+			}
+		}, w)
+		saveDialog.SetFileName("dropbox_ignore_service.log")
+		saveDialog.Show()
+	})
 	logsContent := container.NewBorder(
-		nil,
-		logsCopyButton,
+		container.NewBorder(nil, nil, logLevelSelect, nil, logSearchEntry),
+		container.NewBorder(nil, nil, nil, container.NewHBox(logClearSelectionButton, logsCopyButton, logsExportButton), logSelectionLabel),
 		nil, nil,
-		logStringSliceList,
+		logList,
 	)
 	logsTab := container.NewTabItemWithIcon("Logs", theme.FileTextIcon(), logsContent)
 
+	alreadyUploadedList := widget.NewList(
+		func() int {
+			return alreadyUploadedSet.Len()
+		},
+		func() fyne.CanvasObject {
+			return widget.NewLabel("")
+		},
+		func(i widget.ListItemID, o fyne.CanvasObject) {
+			// multithreading
+			name := alreadyUploadedSet.GetOrEmptyString(i)
+
+			label := o.(*widget.Label)
+			label.SetText(name)
+		},
+	)
+	alreadyUploadedTopLabel := widget.NewLabel("")
+	updateAlreadyUploadedTopLabel := func() {
+		alreadyUploadedTopLabel.SetText(fmt.Sprintf("%d elements are ignored but already uploaded — delete them from dropbox.com to reclaim space", alreadyUploadedSet.Len()) + rootCountsText(alreadyUploadedSet))
+	}
+	alreadyUploadedSet.AddChangeEventListener(Debounce(func() {
+		updateAlreadyUploadedTopLabel()
+		alreadyUploadedList.Refresh()
+	}, time.Second/60))
+	updateAlreadyUploadedTopLabel()
+	alreadyUploadedContent := container.NewBorder(
+		alreadyUploadedTopLabel,
+		nil, nil, nil,
+		alreadyUploadedList,
+	)
+	alreadyUploadedTab := container.NewTabItemWithIcon("Already Uploaded", theme.UploadIcon(), alreadyUploadedContent)
+
 	autostartEnabled, err := IsAutoStartEnabled()
 	if err != nil {
 		return fmt.Errorf("error checking if autostart is enabled: %w", err)
@@ -405,12 +677,12 @@ func ShowGUI(ctx context.Context, dropboxIgnorers []*DropboxIgnorer, hideGUI boo
 		if value {
 			err = EnableAutoStart()
 			if err != nil {
-				log.Printf("error enable autostart: %s", err)
+				logger.Error("enabling autostart failed", LogKeyError, err)
 			}
 		} else {
 			err = DisableAutoStart()
 			if err != nil {
-				log.Printf("error disable autostart: %s", err)
+				logger.Error("disabling autostart failed", LogKeyError, err)
 			}
 		}
 		if err != nil {
@@ -418,14 +690,60 @@ func ShowGUI(ctx context.Context, dropboxIgnorers []*DropboxIgnorer, hideGUI boo
 		}
 	})
 	autoStartCheckBox.SetChecked(autostartEnabled)
+
+	// the config file is edited as json, it is validated before it gets saved
+	configEntry := widget.NewMultiLineEntry()
+	configEntry.TextStyle.Monospace = true
+	configErrorLabel := widget.NewLabel("")
+	configErrorLabel.Wrapping = fyne.TextWrapWord
+	configErrorLabel.Hide()
+	showConfigError := func(err error) {
+		if err == nil {
+			configErrorLabel.Hide()
+			return
+		}
+		configErrorLabel.SetText(err.Error())
+		configErrorLabel.Show()
+	}
+	loadConfigEntry := func() {
+		data, err := config.ReadFile()
+		if err != nil {
+			showConfigError(err)
+			return
+		}
+		configEntry.SetText(string(data))
+	}
+	loadConfigEntry()
+	config.AddChangeEventListener(func(Config, Config) {
+		loadConfigEntry()
+	})
+	configSaveButton := widget.NewButtonWithIcon("Save", theme.DocumentSaveIcon(), func() {
+		data := []byte(configEntry.Text)
+		// a changed config restarts the dropbox ignorers, that walk the dropbox folders again
+		go func() {
+			err := config.Save(data)
+			if err != nil {
+				logger.Error("saving config failed", LogKeyError, err)
+			}
+			showConfigError(err)
+		}()
+	})
+	configRevertButton := widget.NewButtonWithIcon("Revert", theme.ContentUndoIcon(), func() {
+		showConfigError(nil)
+		loadConfigEntry()
+	})
+	configContent := container.NewBorder(
+		widget.NewLabel("Config file "+config.Path()+", the command line flags override it:"),
+		container.NewVBox(configErrorLabel, container.NewHBox(configSaveButton, configRevertButton)),
+		nil, nil,
+		configEntry,
+	)
+
 	quitButton := widget.NewButtonWithIcon("Quit Application", theme.LogoutIcon(), func() {
-		log.Printf("quit button clicked")
+		logger.Info("quit button clicked")
 		a.Quit()
 	})
 	settingsContent := container.NewBorder(
-		nil,
-		quitButton,
-		nil, nil,
 		container.NewVBox(
 			autoStartCheckBox,
 			container.NewBorder(
@@ -434,6 +752,9 @@ func ShowGUI(ctx context.Context, dropboxIgnorers []*DropboxIgnorer, hideGUI boo
 				nil, nil,
 			),
 		),
+		quitButton,
+		nil, nil,
+		configContent,
 	)
 	// settingsTab := container.NewTabItem("Settings", settingsContent)
 	settingsTab := container.NewTabItemWithIcon("Settings", theme.SettingsIcon(), settingsContent)
@@ -442,12 +763,24 @@ func ShowGUI(ctx context.Context, dropboxIgnorers []*DropboxIgnorer, hideGUI boo
 		homeTab,
 		ignoredFilesTab,
 		dropboxIgnoreFileTab,
+		alreadyUploadedTab,
 		logsTab,
 		settingsTab,
 	)
 
+	updateTrayWatcherState := func(string) {}
+	updateTrayPauseState := func(bool) {}
 	if desk, ok := a.(desktop.App); ok {
+		watcherStateMenuItem := fyne.NewMenuItem(watcherStateText(), nil)
+		watcherStateMenuItem.Disabled = true
+		pauseMenuItem := fyne.NewMenuItem("Pause all", func() {
+			ignorers := manager.Ignorers()
+			setPaused(ignorers, anyRunning(ignorers))
+		})
 		var m *fyne.Menu = fyne.NewMenu(appNameToUserDisplay(a),
+			watcherStateMenuItem,
+			pauseMenuItem,
+			fyne.NewMenuItemSeparator(),
 			fyne.NewMenuItem("Show", func() {
 				w.Show()
 			}),
@@ -470,15 +803,93 @@ func ShowGUI(ctx context.Context, dropboxIgnorers []*DropboxIgnorer, hideGUI boo
 		desk.SetSystemTrayMenu(m)
 		systray.SetTitle(m.Label)
 		systray.SetTooltip(m.Label)
+
+		updateTrayWatcherState = func(text string) {
+			watcherStateMenuItem.Label = text
+			m.Refresh()
+			systray.SetTooltip(m.Label + "\n" + text)
+		}
+		updateTrayPauseState = func(anyRunning bool) {
+			pauseMenuItem.Label = "Resume all"
+			if anyRunning {
+				pauseMenuItem.Label = "Pause all"
+			}
+			m.Refresh()
+		}
 	}
+	updatePauseState = func() {
+		if anyRunning(pauseTargets()) {
+			pauseButton.SetText("Pause")
+		} else {
+			pauseButton.SetText("Resume")
+		}
+		ignorers := manager.Ignorers()
+		updateTrayPauseState(anyRunning(ignorers))
+
+		var pausedPaths []string
+		for _, d := range ignorers {
+			if d.Paused() {
+				pausedPaths = append(pausedPaths, d.DropboxPath())
+			}
+		}
+		if len(pausedPaths) == 0 {
+			pausedLabel.Hide()
+			return
+		}
+		pausedLabel.SetText(fmt.Sprintf("Paused, changes are handled at resume: %s", strings.Join(pausedPaths, ", ")))
+		pausedLabel.Show()
+	}
+	updateWatcherState := func() {
+		text := watcherStateText()
+		watcherStateLabel.SetText(text)
+		updateTrayWatcherState(text)
+	}
+	// the listeners of stopped dropbox ignorers stay registered, but they do not get called anymore
+	var registeredIgnorersMutex sync.Mutex
+	registeredIgnorers := map[*DropboxIgnorer]bool{}
+	registerIgnorers := func() {
+		registeredIgnorersMutex.Lock()
+		defer registeredIgnorersMutex.Unlock()
+
+		for _, d := range manager.Ignorers() {
+			if registeredIgnorers[d] {
+				continue
+			}
+			registeredIgnorers[d] = true
+			d.AddOverflowRescanEventListener(updateOverflowRescanLabel)
+			d.AddFlagStrippedEventListener(updateFlagsStrippedLabel)
+			d.AddWatcherStateEventListener(func(WatcherState) {
+				updateWatcherState()
+			})
+			d.AddPauseEventListener(func(bool) {
+				updatePauseState()
+			})
+			d.AddDriftReportEventListener(func(DriftReport) {
+				updateDriftLabel()
+			})
+		}
+	}
+	registerIgnorers()
+	manager.AddRootsChangeEventListener(func() {
+		registerIgnorers()
+		updateIgnoreFileItems()
+		ignoreFilesSetList.Refresh()
+		updateHomeRootSelect()
+		updateHomeTopLabel()
+		updateOverflowRescanLabel()
+		updateWatcherState()
+		updatePauseState()
+		updateDriftLabel()
+	})
+	updatePauseState()
 
 	tabs.OnSelected = func(ti *container.TabItem) {
 		if ti == ignoredFilesTab {
 			ignoredFilesContentError.Hide()
 			go func() {
 				err := reScanIgnoredFiles()
-				if err != nil && !errors.Is(err, ignoredFilesCtxStopError) {
-					log.Printf("Error scanning files: %s", err)
+				if err != nil && !errors.Is(err, context.Canceled) {
+					logger.Error("scanning ignored files failed", LogKeyError, err)
 					ignoredFilesContentError.SetText(fmt.Sprintf("error scanning files: %s", err))
 					ignoredFilesContentError.Show()
 				}
@@ -491,9 +902,17 @@ func ShowGUI(ctx context.Context, dropboxIgnorers []*DropboxIgnorer, hideGUI boo
 	}
 	w.SetContent(tabs)
 
+	if control != nil {
+		// a second launch shows the window of this instance
+		control.addShowWindowEventListener(func() {
+			w.Show()
+			w.RequestFocus()
+		})
+	}
+
 	// SetCloseIntercept => will hide the application instead of closing it
 	w.SetCloseIntercept(func() {
-		log.Printf("Close intercept: hide window")
+		logger.Debug("close intercept: hide window")
 		w.Hide()
 	})
 	go func() {
@@ -501,6 +920,20 @@ func ShowGUI(ctx context.Context, dropboxIgnorers []*DropboxIgnorer, hideGUI boo
 		a.Quit()
 	}()
 
+	notificationEvents := manager.Events().Subscribe(100)
+	go func() {
+		defer notificationEvents.Unsubscribe()
+		notifier := newEventNotifier(a)
+		for {
+			select {
+			case <-guiCtx.Done():
+				return
+			case e := <-notificationEvents.C:
+				notifier.notify(config.Config().Notifications, e)
+			}
+		}
+	}()
+
 	if hideGUI {
 		// run only launches the application without showing window
 		a.Run()
@@ -512,6 +945,81 @@ func ShowGUI(ctx context.Context, dropboxIgnorers []*DropboxIgnorer, hideGUI boo
 	return nil
 }
 
+// rootCountsText returns the number of elements per dropbox folder, if there are multiple dropbox folders
+func rootCountsText(set *RootAwareSet) string {
+	roots := set.Roots()
+	if len(roots) < 2 {
+		return ""
+	}
+	text := ""
+	for _, root := range roots {
+		text += fmt.Sprintf("\n%s: %d", root, set.RootLen(root))
+	}
+	return text
+}
+
+// eventNotifier sends the notifications of the ignorer events.
+// The paths ignored by a walk of a whole dropbox folder are counted and sent as one notification after the walk.
+type eventNotifier struct {
+	app fyne.App
+	// scans are the running walks by dropbox folder
+	scans map[string]*scanNotification
+}
+
+type scanNotification struct {
+	cause   EventCause
+	ignored int
+	tryRun  bool
+}
+
+func newEventNotifier(a fyne.App) *eventNotifier {
+	return &eventNotifier{
+		app:   a,
+		scans: map[string]*scanNotification{},
+	}
+}
+
+func (n *eventNotifier) notify(notifications NotificationsConfig, e IgnorerEvent) {
+	switch e.Type {
+	case EventScanStarted:
+		n.scans[e.Root] = &scanNotification{cause: e.Cause}
+	case EventScanFinished:
+		scan := n.scans[e.Root]
+		delete(n.scans, e.Root)
+		if scan == nil || scan.ignored == 0 || !notifications.PathIgnored {
+			return
+		}
+		title := "DropboxIgnoreFlag added"
+		if scan.tryRun {
+			title = "tryRun: DropboxIgnoreFlag would be added"
+		}
+		n.app.SendNotification(fyne.NewNotification(title, fmt.Sprintf("%d paths by the %s of %s", scan.ignored, scan.cause, e.Root)))
+	case EventPathIgnored:
+		if scan := n.scans[e.Root]; scan != nil && e.Cause == scan.cause {
+			if !e.AlreadyFlagged {
+				scan.ignored++
+				scan.tryRun = e.TryRun
+			}
+			return
+		}
+		if !notifications.PathIgnored {
+			return
+		}
+		title := "DropboxIgnoreFlag added"
+		if e.TryRun {
+			title = "tryRun: DropboxIgnoreFlag would be added"
+		} else if e.Cause == CauseFlagStripped {
+			title = "DropboxIgnoreFlag stripped externally, added again"
+		}
+		n.app.SendNotification(fyne.NewNotification(title, fmt.Sprintf("%s\nrule %s of %s", e.Path, e.Rule, e.IgnoreFile)))
+	case EventIgnoreFileInvalid:
+		if !notifications.InvalidIgnoreFile {
+			return
+		}
+		n.app.SendNotification(fyne.NewNotification("Invalid "+DropboxIgnoreFilename+" file", e.Err.Error()))
+	}
+}
+
 func ShowError(errorText string) {
 	a := app.New()
 	w := a.NewWindow(appNameToUserDisplay(a))
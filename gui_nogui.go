@@ -0,0 +1,19 @@
+//go:build nogui
+
+package main
+
+import (
+	"context"
+	"log/slog"
+)
+
+// ShowGUI of the headless build runs the dropbox ignorers until SIGINT/SIGTERM, it has no window to show
+func ShowGUI(ctx context.Context, manager *RootManager, control *ControlService, config *ConfigStore, hideGUI bool, logStore *LogStore) error {
+	componentLogger(slog.Default(), LogComponentGUI).Info("running without gui, stop with SIGINT/SIGTERM")
+	<-ctx.Done()
+	return nil
+}
+
+// ShowError has no window to show the error in, main logs it to stderr
+func ShowError(errorText string) {
+}
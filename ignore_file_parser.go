@@ -136,7 +136,26 @@ func ParseIgnoreFileFromBytes(filename string, fileBytes []byte) (IgnorePattern,
 	return patterns, nil
 }
 
+// IgnoreRuleSource returns the line number (starting at 1) and the text of the line of the ignore file, that creates pattern
+func IgnoreRuleSource(filename string, fileBytes []byte, pattern string) (int, string, bool) {
+	ignoreLines := regexp.MustCompile("\r?\n").Split(string(fileBytes), -1)
+	for lineI, ignoreLine := range ignoreLines {
+		// every line is parsed on its own
+		patterns, err := ParseIgnoreFileFromBytes(filename, []byte(ignoreLine))
+		if err == nil && len(patterns) == 1 && patterns[0] == pattern {
+			return lineI + 1, ignoreLine, true
+		}
+	}
+	return 0, "", false
+}
+
 func IsIgnored(patterns IgnorePattern, path string) bool {
+	_, ok := MatchingPattern(patterns, path)
+	return ok
+}
+
+// MatchingPattern returns the first pattern, that matches path
+func MatchingPattern(patterns IgnorePattern, path string) (string, bool) {
 	for _, ignorePattern := range patterns {
 		match, err := doublestar.Match(ignorePattern, filepath.ToSlash(path))
 		if err != nil {
@@ -144,9 +163,26 @@ func IsIgnored(patterns IgnorePattern, path string) bool {
 			panic(err)
 		}
 		if match {
-			return true
+			return ignorePattern, true
+		}
+	}
+
+	return "", false
+}
+
+// MatchingPatternFold is MatchingPattern ignoring the case, e.g. for case-insensitive filesystems
+func MatchingPatternFold(patterns IgnorePattern, path string) (string, bool) {
+	lowerPath := strings.ToLower(filepath.ToSlash(path))
+	for _, ignorePattern := range patterns {
+		match, err := doublestar.Match(strings.ToLower(ignorePattern), lowerPath)
+		if err != nil {
+			// bad
+			panic(err)
+		}
+		if match {
+			return ignorePattern, true
 		}
 	}
 
-	return false
+	return "", false
 }
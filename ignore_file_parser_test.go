@@ -672,3 +672,36 @@ func TestParseIgnoreFileFromBytes(t *testing.T) {
 		}
 	}
 }
+
+func TestMatchingPatternFold(t *testing.T) {
+	root := t.TempDir()
+	patterns, err := main.ParseIgnoreFileFromBytes(filepath.Join(root, main.DropboxIgnoreFilename), []byte("node_modules\n"))
+	requireNoError(t, err)
+
+	path := filepath.Join(root, "sub", "Node_Modules")
+	_, ok := main.MatchingPattern(patterns, path)
+	require.False(t, ok)
+	pattern, ok := main.MatchingPatternFold(patterns, path)
+	require.True(t, ok)
+	require.Equal(t, patterns[0], pattern)
+}
+
+func TestIgnoreRuleSource(t *testing.T) {
+	root := t.TempDir()
+	filename := filepath.Join(root, main.DropboxIgnoreFilename)
+	data := []byte("# build output\r\nbuild/\n\nnode_modules\n")
+	patterns, err := main.ParseIgnoreFileFromBytes(filename, data)
+	requireNoError(t, err)
+	require.Len(t, patterns, 2)
+
+	line, text, ok := main.IgnoreRuleSource(filename, data, patterns[1])
+	require.True(t, ok)
+	require.Equal(t, 4, line)
+	require.Equal(t, "node_modules", text)
+	line, text, ok = main.IgnoreRuleSource(filename, data, patterns[0])
+	require.True(t, ok)
+	require.Equal(t, 2, line)
+	require.Equal(t, "build/", text)
+	_, _, ok = main.IgnoreRuleSource(filename, data, filepath.Join(root, "other"))
+	require.False(t, ok)
+}
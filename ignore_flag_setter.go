@@ -4,6 +4,8 @@ type Implementation interface {
 	SetFlag(path string) error
 	RemoveFlag(path string) error
 	HasFlag(path string) (bool, error)
+	// HasSyncAttributes reports if dropbox stored its sync attributes, then the path is already uploaded
+	HasSyncAttributes(path string) (bool, error)
 }
 
 func SetDropboxIgnoreFlag(path string) error {
@@ -17,3 +19,7 @@ func RemoveDropboxIgnoreFlag(path string) error {
 func HasDropboxIgnoreFlag(path string) (bool, error) {
 	return implementation.HasFlag(path)
 }
+
+func HasDropboxSyncAttributes(path string) (bool, error) {
+	return implementation.HasSyncAttributes(path)
+}
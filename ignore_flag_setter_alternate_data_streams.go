@@ -34,4 +34,15 @@ func (*implementationAlternateDataStreams) HasFlag(path string) (bool, error) {
 	return bytes.Equal(b, []byte("1")), nil
 }
 
+func (*implementationAlternateDataStreams) HasSyncAttributes(path string) (bool, error) {
+	_, err := os.Stat(path + ":com.dropbox.attrs")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
 var implementation *implementationAlternateDataStreams
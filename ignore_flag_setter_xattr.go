@@ -6,6 +6,7 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"slices"
 
 	"github.com/pkg/xattr"
 )
@@ -75,4 +76,15 @@ func (*implementationXattr) HasFlag(path string) (bool, error) {
 	return bytes.Equal([]byte("1"), b), nil
 }
 
+func (*implementationXattr) HasSyncAttributes(path string) (bool, error) {
+	if !xattr.XATTR_SUPPORTED {
+		return false, fmt.Errorf("xattr not supported")
+	}
+	attrs, err := xattr.List(path)
+	if err != nil {
+		return false, handleXattrErr(err)
+	}
+	return slices.Contains(attrs, "user.com.dropbox.attrs"), nil
+}
+
 var implementation *implementationXattr
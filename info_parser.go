@@ -1,12 +1,26 @@
 package main
 
 import (
+	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
 	"os/user"
 	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// DropboxInfoFileEnv overrides the location of the dropbox config file (info.json or host.db)
+const DropboxInfoFileEnv = "DROPBOX_INFO_FILE"
+
+var ErrNoDropboxInfoFile = errors.New("no dropbox info file found")
+
+const (
+	DropboxAccountPersonal = "personal"
+	DropboxAccountBusiness = "business"
 )
 
 type DropboxInfoEntry struct {
@@ -19,18 +33,30 @@ type DropboxInfoEntry struct {
 // may be be personal os business, but make a map for simplicity
 type DropboxInfo map[string]DropboxInfoEntry
 
-func ParseDropboxInfoPaths() ([]string, error) {
-	// possible config locations:
-	// %APPDATA%\Dropbox\info.json
-	// %LOCALAPPDATA%\Dropbox\info.json
-	// ~/.dropbox/info.json
+type DropboxAccount struct {
+	// Type is personal or business
+	Type             string
+	Path             string
+	Host             uint64
+	IsTeam           bool
+	SubscriptionType string
+	// ConfigFile is the dropbox config file the account was read from
+	ConfigFile string
+}
 
+// DropboxConfigLocations returns the possible dropbox config files in the order they get checked
+func DropboxConfigLocations(homeDir string) []string {
 	locations := []string{}
-	user, err := user.Current()
-	if err != nil {
-		return nil, fmt.Errorf("error getting user: %w", err)
+	if infoFile, found := os.LookupEnv(DropboxInfoFileEnv); found && infoFile != "" {
+		locations = append(locations, infoFile)
 	}
-	locations = append(locations, filepath.Join(user.HomeDir, ".dropbox", "info.json"))
+	locations = append(locations,
+		filepath.Join(homeDir, ".dropbox", "info.json"),
+		// Flatpak
+		filepath.Join(homeDir, ".var", "app", "com.dropbox.Client", ".dropbox", "info.json"),
+		// Snap
+		filepath.Join(homeDir, "snap", "dropbox", "current", ".dropbox", "info.json"),
+	)
 
 	appData, found := os.LookupEnv("APPDATA")
 	if found {
@@ -41,8 +67,20 @@ func ParseDropboxInfoPaths() ([]string, error) {
 		locations = append(locations, filepath.Join(localAppData, "Dropbox", "info.json"))
 	}
 
-	for _, location := range locations {
-		bytes, err := os.ReadFile(location)
+	// legacy dropbox versions
+	locations = append(locations, filepath.Join(homeDir, ".dropbox", "host.db"))
+	return locations
+}
+
+// ParseDropboxAccounts returns the accounts of the first found dropbox config file
+func ParseDropboxAccounts() ([]DropboxAccount, error) {
+	user, err := user.Current()
+	if err != nil {
+		return nil, fmt.Errorf("error getting user: %w", err)
+	}
+
+	for _, location := range DropboxConfigLocations(user.HomeDir) {
+		data, err := os.ReadFile(location)
 		if err != nil {
 			if !errors.Is(err, os.ErrNotExist) {
 				return nil, fmt.Errorf("error reading dropbox config file %s: %s", location, err)
@@ -50,20 +88,77 @@ func ParseDropboxInfoPaths() ([]string, error) {
 			continue
 		}
 
-		info := DropboxInfo{}
-		err = json.Unmarshal(bytes, &info)
-		if err != nil {
-			return nil, fmt.Errorf("error parsing dropbox config file %s: %s", location, err)
-		}
-
-		paths := []string{}
-		for _, value := range info {
-			paths = append(paths, value.Path)
+		if filepath.Base(location) == "host.db" {
+			return ParseDropboxHostDB(data, location)
 		}
-		return paths, nil
+		return ParseDropboxInfo(data, location)
 	}
 
 	// no dropbox info file found
-	// return nil, nil
-	return nil, fmt.Errorf("no dropbox info file found")
+	return nil, ErrNoDropboxInfoFile
+}
+
+// ParseDropboxInfo parses the content of an info.json file, the accounts are sorted by their type
+func ParseDropboxInfo(data []byte, configFile string) ([]DropboxAccount, error) {
+	info := DropboxInfo{}
+	err := json.Unmarshal(data, &info)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing dropbox config file %s: %s", configFile, err)
+	}
+
+	accounts := []DropboxAccount{}
+	for accountType, value := range info {
+		accounts = append(accounts, DropboxAccount{
+			Type:             accountType,
+			Path:             value.Path,
+			Host:             value.Host,
+			IsTeam:           value.IsTeam,
+			SubscriptionType: value.SubscriptionType,
+			ConfigFile:       configFile,
+		})
+	}
+	slices.SortFunc(accounts, func(a, b DropboxAccount) int {
+		return strings.Compare(a.Type, b.Type)
+	})
+	return accounts, nil
+}
+
+// ParseDropboxHostDB parses the content of a host.db file.
+// The second line is the base64 encoded path of the only (personal) dropbox folder.
+func ParseDropboxHostDB(data []byte, configFile string) ([]DropboxAccount, error) {
+	lines := bytes.Split(bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n")), []byte("\n"))
+	if len(lines) < 2 || len(bytes.TrimSpace(lines[1])) == 0 {
+		return nil, fmt.Errorf("error parsing dropbox config file %s: missing dropbox path", configFile)
+	}
+	path, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(lines[1])))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing dropbox config file %s: %s", configFile, err)
+	}
+
+	return []DropboxAccount{
+		{
+			Type:       DropboxAccountPersonal,
+			Path:       string(path),
+			ConfigFile: configFile,
+		},
+	}, nil
+}
+
+// FilterDropboxAccounts returns the accounts of accountType, all accounts if accountType is empty
+func FilterDropboxAccounts(accounts []DropboxAccount, accountType string) ([]DropboxAccount, error) {
+	switch accountType {
+	case "":
+		return accounts, nil
+	case DropboxAccountPersonal, DropboxAccountBusiness:
+	default:
+		return nil, fmt.Errorf("unknown dropbox account %q, expected %s or %s", accountType, DropboxAccountPersonal, DropboxAccountBusiness)
+	}
+
+	filtered := []DropboxAccount{}
+	for _, account := range accounts {
+		if account.Type == accountType {
+			filtered = append(filtered, account)
+		}
+	}
+	return filtered, nil
 }
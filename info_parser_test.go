@@ -0,0 +1,105 @@
+package main_test
+
+import (
+	"encoding/base64"
+	"path/filepath"
+	"testing"
+
+	main "github.com/anton15x/dropbox_ignore_service"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDropboxInfo(t *testing.T) {
+	CheckTestParallel(t)
+
+	data := []byte(`{
+		"personal": {"path": "/home/user/Dropbox", "host": 123, "is_team": false, "subscription_type": "Basic"},
+		"business": {"path": "/home/user/Dropbox (Company)", "host": 456, "is_team": true, "subscription_type": "Business"}
+	}`)
+	accounts, err := main.ParseDropboxInfo(data, "info.json")
+	requireNoError(t, err)
+	require.Equal(t, []main.DropboxAccount{
+		{
+			Type:             main.DropboxAccountBusiness,
+			Path:             "/home/user/Dropbox (Company)",
+			Host:             456,
+			IsTeam:           true,
+			SubscriptionType: "Business",
+			ConfigFile:       "info.json",
+		},
+		{
+			Type:             main.DropboxAccountPersonal,
+			Path:             "/home/user/Dropbox",
+			Host:             123,
+			SubscriptionType: "Basic",
+			ConfigFile:       "info.json",
+		},
+	}, accounts)
+
+	_, err = main.ParseDropboxInfo([]byte("{"), "info.json")
+	require.Error(t, err)
+}
+
+func TestParseDropboxHostDB(t *testing.T) {
+	CheckTestParallel(t)
+
+	path := "/home/user/Dropbox"
+	data := []byte("0123456789abcdef\n" + base64.StdEncoding.EncodeToString([]byte(path)) + "\n")
+	accounts, err := main.ParseDropboxHostDB(data, "host.db")
+	requireNoError(t, err)
+	require.Equal(t, []main.DropboxAccount{
+		{
+			Type:       main.DropboxAccountPersonal,
+			Path:       path,
+			ConfigFile: "host.db",
+		},
+	}, accounts)
+
+	_, err = main.ParseDropboxHostDB([]byte("0123456789abcdef\n"), "host.db")
+	require.Error(t, err)
+	_, err = main.ParseDropboxHostDB([]byte("0123456789abcdef\nnot base64!"), "host.db")
+	require.Error(t, err)
+}
+
+func TestFilterDropboxAccounts(t *testing.T) {
+	CheckTestParallel(t)
+
+	accounts := []main.DropboxAccount{
+		{Type: main.DropboxAccountBusiness, Path: "b"},
+		{Type: main.DropboxAccountPersonal, Path: "p"},
+	}
+
+	filtered, err := main.FilterDropboxAccounts(accounts, "")
+	requireNoError(t, err)
+	require.Equal(t, accounts, filtered)
+
+	filtered, err = main.FilterDropboxAccounts(accounts, main.DropboxAccountPersonal)
+	requireNoError(t, err)
+	require.Equal(t, accounts[1:], filtered)
+
+	filtered, err = main.FilterDropboxAccounts(accounts[1:], main.DropboxAccountBusiness)
+	requireNoError(t, err)
+	require.Empty(t, filtered)
+
+	_, err = main.FilterDropboxAccounts(accounts, "team")
+	require.Error(t, err)
+}
+
+func TestDropboxConfigLocations(t *testing.T) {
+	// no CheckTestParallel, t.Setenv does not work in parallel tests
+	home := filepath.Join("home", "user")
+	infoFile := filepath.Join("custom", "info.json")
+	t.Setenv(main.DropboxInfoFileEnv, infoFile)
+	t.Setenv("APPDATA", "appdata")
+	t.Setenv("LOCALAPPDATA", "localappdata")
+
+	require.Equal(t, []string{
+		infoFile,
+		filepath.Join(home, ".dropbox", "info.json"),
+		filepath.Join(home, ".var", "app", "com.dropbox.Client", ".dropbox", "info.json"),
+		filepath.Join(home, "snap", "dropbox", "current", ".dropbox", "info.json"),
+		filepath.Join("appdata", "Dropbox", "info.json"),
+		filepath.Join("localappdata", "Dropbox", "info.json"),
+		filepath.Join(home, ".dropbox", "host.db"),
+	}, main.DropboxConfigLocations(home))
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var ErrInstanceRunning = errors.New("another instance is running")
+
+// InstanceInfo is written to the lock file by the running service
+type InstanceInfo struct {
+	PID int `json:"pid"`
+	// Socket is the control socket of the running service, empty if it has none
+	Socket  string    `json:"socket"`
+	Started time.Time `json:"started"`
+}
+
+// InstanceLockPath returns the per-user lock file of the running service
+func InstanceLockPath() string {
+	return ControlSocketPath() + ".lock"
+}
+
+// InstanceLock is held by the running service, the operating system releases it if the process crashes
+type InstanceLock struct {
+	file *os.File
+}
+
+// AcquireInstanceLock locks path and writes info to it, ErrInstanceRunning if another process holds the lock.
+// The info left behind by a crashed process is logged as stale.
+func AcquireInstanceLock(path string, info InstanceInfo, logger *slog.Logger) (*InstanceLock, error) {
+	err := os.MkdirAll(filepath.Dir(path), 0o700)
+	if err != nil {
+		return nil, fmt.Errorf("error creating dir of instance lock: %w", err)
+	}
+	// another user could replace the lock file in a shared dir
+	err = checkPrivateDir(filepath.Dir(path))
+	if err != nil {
+		return nil, fmt.Errorf("error checking dir of instance lock: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("error opening instance lock: %w", err)
+	}
+	err = lockFile(file)
+	if err != nil {
+		_ = file.Close()
+		if errors.Is(err, ErrInstanceRunning) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("error locking instance lock %s: %w", path, err)
+	}
+
+	// Release empties the file, content is left by a crashed process
+	stale, err := readInstanceInfo(file)
+	if err == nil {
+		componentLogger(logger, LogComponentLock).Warn("stale instance lock of crashed process detected", LogKeyPath, path, "pid", stale.PID, "started", stale.Started)
+	}
+
+	data, err := json.Marshal(info)
+	if err == nil {
+		err = file.Truncate(0)
+	}
+	if err == nil {
+		_, err = file.WriteAt(data, 0)
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if err != nil {
+		_ = unlockFile(file)
+		_ = file.Close()
+		return nil, fmt.Errorf("error writing instance lock %s: %w", path, err)
+	}
+	return &InstanceLock{file: file}, nil
+}
+
+// Release empties and unlocks the lock file, it is not removed so that every process locks the same file
+func (l *InstanceLock) Release() error {
+	err := l.file.Truncate(0)
+	return errors.Join(err, unlockFile(l.file), l.file.Close())
+}
+
+// ReadInstanceInfo returns the info of the process holding the lock file path
+func ReadInstanceInfo(path string) (InstanceInfo, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return InstanceInfo{}, fmt.Errorf("error opening instance lock: %w", err)
+	}
+	defer file.Close()
+	return readInstanceInfo(file)
+}
+
+func readInstanceInfo(file *os.File) (InstanceInfo, error) {
+	data, err := io.ReadAll(io.NewSectionReader(file, 0, 1<<20))
+	if err != nil {
+		return InstanceInfo{}, fmt.Errorf("error reading instance lock: %w", err)
+	}
+	if len(data) == 0 {
+		return InstanceInfo{}, fmt.Errorf("instance lock is empty")
+	}
+	var info InstanceInfo
+	err = json.Unmarshal(data, &info)
+	if err != nil {
+		return InstanceInfo{}, fmt.Errorf("error parsing instance lock: %w", err)
+	}
+	return info, nil
+}
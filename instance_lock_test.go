@@ -0,0 +1,46 @@
+package main_test
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	main "github.com/anton15x/dropbox_ignore_service"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstanceLock(t *testing.T) {
+	CheckTestParallel(t)
+
+	path := filepath.Join(t.TempDir(), "run", "instance.lock")
+	info := main.InstanceInfo{PID: os.Getpid(), Socket: "/run/test.sock", Started: time.Now().Round(time.Second)}
+	logger := NewTestLogger(t)
+
+	lock, err := main.AcquireInstanceLock(path, info, logger)
+	requireNoError(t, err)
+	_, err = main.AcquireInstanceLock(path, main.InstanceInfo{PID: 1}, logger)
+	require.ErrorIs(t, err, main.ErrInstanceRunning)
+	runningInfo, err := main.ReadInstanceInfo(path)
+	requireNoError(t, err)
+	require.True(t, info.Started.Equal(runningInfo.Started))
+	require.Equal(t, info.Socket, runningInfo.Socket)
+
+	requireNoError(t, lock.Release())
+	_, err = main.ReadInstanceInfo(path)
+	require.Error(t, err, "released lock is empty")
+	lock, err = main.AcquireInstanceLock(path, info, logger)
+	requireNoError(t, err)
+	requireNoError(t, lock.Release())
+
+	// a crashed process leaves its info behind, but not the lock
+	requireNoError(t, os.WriteFile(path, []byte(`{"pid": 123}`), 0o600))
+	var logs bytes.Buffer
+	lock, err = main.AcquireInstanceLock(path, info, slog.New(slog.NewTextHandler(&logs, nil)))
+	requireNoError(t, err)
+	defer lock.Release()
+	require.Contains(t, logs.String(), "stale instance lock of crashed process detected")
+	require.Contains(t, logs.String(), "pid=123")
+}
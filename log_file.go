@@ -0,0 +1,337 @@
+package main
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const logFileName = "dropbox_ignore_service.log"
+
+// logFileMode is the mode of the log file and the rotated files
+const logFileMode = 0o600
+
+// the default rotation of the log file
+const (
+	DefaultLogMaxSize  = 10
+	DefaultLogMaxAge   = 7 * 24 * time.Hour
+	DefaultLogMaxFiles = 5
+)
+
+// logFileTimeFormat is part of the names of the rotated log files, they sort by time
+const logFileTimeFormat = "20060102T150405.000"
+
+// DefaultLogPath returns the log file in the state dir of the user, it is used by autostart
+func DefaultLogPath() string {
+	home, _ := os.UserHomeDir()
+	switch runtime.GOOS {
+	case "windows":
+		dir, err := os.UserCacheDir()
+		if err == nil {
+			return filepath.Join(dir, "dropbox_ignore_service", logFileName)
+		}
+	case "darwin":
+		return filepath.Join(home, "Library", "Logs", "dropbox_ignore_service", logFileName)
+	}
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "dropbox_ignore_service", logFileName)
+	}
+	return filepath.Join(home, ".local", "state", "dropbox_ignore_service", logFileName)
+}
+
+// LogRotation are the limits of the log file, 0 disables a limit
+type LogRotation struct {
+	// MaxSize in bytes rotates the log file, before it gets larger
+	MaxSize int64
+	// MaxAge rotates the log file, after it was written to for this duration
+	MaxAge time.Duration
+	// MaxFiles is the number of rotated log files, that are kept
+	MaxFiles int
+	// Compress gzips the rotated log files
+	Compress bool
+}
+
+// LogFile appends to the log file and rotates it.
+// The file and the rotation can change while the service runs.
+type LogFile struct {
+	m        sync.Mutex
+	path     string
+	file     *os.File
+	size     int64
+	started  time.Time
+	rotation LogRotation
+
+	// millMutex serializes the compression and removal of the rotated files, that run in the background
+	millMutex sync.Mutex
+	millWg    sync.WaitGroup
+}
+
+func NewLogFile(rotation LogRotation) *LogFile {
+	return &LogFile{rotation: rotation}
+}
+
+// Write never fails because of the rotation, the other writers of a io.MultiWriter would miss the log
+func (f *LogFile) Write(p []byte) (int, error) {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	if f.file == nil {
+		return len(p), nil
+	}
+	if f.shouldRotate(int64(len(p))) {
+		err := f.rotate()
+		if err != nil {
+			// the current file is kept, it is tried again at the next write
+			_, _ = fmt.Fprintf(f.file, "error rotating log file: %s\n", err)
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *LogFile) shouldRotate(size int64) bool {
+	if f.size == 0 {
+		return false
+	}
+	if f.rotation.MaxSize > 0 && f.size+size > f.rotation.MaxSize {
+		return true
+	}
+	return f.rotation.MaxAge > 0 && time.Since(f.started) >= f.rotation.MaxAge
+}
+
+// SetPath opens the log file path, empty disables file logging. The old file stays open on error.
+func (f *LogFile) SetPath(path string) error {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	if path == f.path {
+		return nil
+	}
+	var file *os.File
+	var size int64
+	if path != "" {
+		var err error
+		file, size, err = openLogFile(path)
+		if err != nil {
+			return err
+		}
+	}
+	var err error
+	if f.file != nil {
+		err = f.file.Close()
+	}
+	f.path = path
+	f.file = file
+	f.size = size
+	f.started = f.lastRotation()
+	f.mill()
+	if err != nil {
+		return fmt.Errorf("error closing log file: %w", err)
+	}
+	return nil
+}
+
+func openLogFile(path string) (*os.File, int64, error) {
+	err := os.MkdirAll(filepath.Dir(path), 0o700)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error creating dir of log file: %w", err)
+	}
+	// the log contains the paths of the user
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, logFileMode)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error open log file %s: %w", path, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, 0, fmt.Errorf("error stat log file %s: %w", path, err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != logFileMode {
+		// created by an older version, the rotated files keep the mode of the log file
+		err = file.Chmod(logFileMode)
+		if err != nil {
+			_ = file.Close()
+			return nil, 0, fmt.Errorf("error changing permissions of log file %s: %w", path, err)
+		}
+	}
+	return file, info.Size(), nil
+}
+
+// SetRotation applies to the current log file, the rotated files are cleaned up in the background
+func (f *LogFile) SetRotation(rotation LogRotation) {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	f.rotation = rotation
+	f.mill()
+}
+
+// Rotate starts a new log file
+func (f *LogFile) Rotate() error {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+	return f.rotate()
+}
+
+func (f *LogFile) rotate() error {
+	// windows can not rename an open file
+	err := f.file.Close()
+	if err != nil {
+		return fmt.Errorf("error closing log file: %w", err)
+	}
+	now := time.Now()
+	renameErr := os.Rename(f.path, f.backupPath(now))
+	file, size, err := openLogFile(f.path)
+	if err != nil {
+		// nothing gets logged anymore, until the log file changes
+		f.path = ""
+		f.file = nil
+		return errors.Join(renameErr, err)
+	}
+	f.file = file
+	f.size = size
+	if renameErr != nil {
+		return fmt.Errorf("error renaming log file: %w", renameErr)
+	}
+	f.started = now
+	f.mill()
+	return nil
+}
+
+// lastRotation returns the time the current log file was started, now if it was never rotated
+func (f *LogFile) lastRotation() time.Time {
+	backups, _ := logFileBackups(f.path)
+	if len(backups) == 0 {
+		return time.Now()
+	}
+	return backups[0].time
+}
+
+func (f *LogFile) backupPath(t time.Time) string {
+	ext := filepath.Ext(f.path)
+	return strings.TrimSuffix(f.path, ext) + "-" + t.Format(logFileTimeFormat) + ext
+}
+
+type logFileBackup struct {
+	path string
+	time time.Time
+}
+
+// logFileBackups returns the rotated files of the log file path, the newest first
+func logFileBackups(path string) ([]logFileBackup, error) {
+	if path == "" {
+		return nil, nil
+	}
+	ext := filepath.Ext(path)
+	prefix := strings.TrimSuffix(filepath.Base(path), ext) + "-"
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		return nil, fmt.Errorf("error reading dir of log file: %w", err)
+	}
+	backups := []logFileBackup{}
+	for _, entry := range entries {
+		name, found := strings.CutPrefix(entry.Name(), prefix)
+		if !found || entry.IsDir() {
+			continue
+		}
+		name = strings.TrimSuffix(name, ".gz")
+		timeText, found := strings.CutSuffix(name, ext)
+		if !found {
+			continue
+		}
+		t, err := time.ParseInLocation(logFileTimeFormat, timeText, time.Local)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, logFileBackup{path: filepath.Join(filepath.Dir(path), entry.Name()), time: t})
+	}
+	slices.SortFunc(backups, func(a, b logFileBackup) int {
+		return b.time.Compare(a.time)
+	})
+	return backups, nil
+}
+
+// mill compresses and removes the rotated log files in the background, f.m must be held
+func (f *LogFile) mill() {
+	path := f.path
+	rotation := f.rotation
+	if path == "" {
+		return
+	}
+	f.millWg.Add(1)
+	go func() {
+		defer f.millWg.Done()
+		f.millMutex.Lock()
+		defer f.millMutex.Unlock()
+
+		backups, err := logFileBackups(path)
+		if err != nil {
+			return
+		}
+		for n, backup := range backups {
+			if rotation.MaxFiles > 0 && n >= rotation.MaxFiles {
+				_ = os.Remove(backup.path)
+				continue
+			}
+			if runtime.GOOS != "windows" {
+				// rotated by an older version
+				_ = os.Chmod(backup.path, logFileMode)
+			}
+			if rotation.Compress && !strings.HasSuffix(backup.path, ".gz") {
+				// a failed compression is tried again at the next rotation
+				_ = compressLogFile(backup.path)
+			}
+		}
+	}()
+}
+
+func compressLogFile(path string) (retErr error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmpPath := path + ".gz.tmp"
+	dst, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, logFileMode)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if retErr != nil {
+			_ = os.Remove(tmpPath)
+		}
+	}()
+	w := gzip.NewWriter(dst)
+	_, err = io.Copy(w, src)
+	err = errors.Join(err, w.Close(), dst.Close())
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmpPath, path+".gz")
+	if err != nil {
+		return err
+	}
+	_ = src.Close()
+	return os.Remove(path)
+}
+
+// Close closes the log file and waits for the cleanup of the rotated files
+func (f *LogFile) Close() error {
+	err := f.SetPath("")
+	f.millWg.Wait()
+	return err
+}
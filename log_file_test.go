@@ -0,0 +1,116 @@
+package main_test
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	main "github.com/anton15x/dropbox_ignore_service"
+	"github.com/stretchr/testify/require"
+)
+
+func readLogFiles(t *testing.T, dir string) map[string]string {
+	entries, err := os.ReadDir(dir)
+	requireNoError(t, err)
+	files := map[string]string{}
+	for _, entry := range entries {
+		file, err := os.Open(filepath.Join(dir, entry.Name()))
+		requireNoError(t, err)
+		var r io.Reader = file
+		if strings.HasSuffix(entry.Name(), ".gz") {
+			r, err = gzip.NewReader(file)
+			requireNoError(t, err)
+		}
+		data, err := io.ReadAll(r)
+		requireNoError(t, err)
+		requireNoError(t, file.Close())
+		files[entry.Name()] = string(data)
+	}
+	return files
+}
+
+func TestLogFileRotation(t *testing.T) {
+	CheckTestParallel(t)
+
+	dir := filepath.Join(t.TempDir(), "logs")
+	path := filepath.Join(dir, "service.log")
+	f := main.NewLogFile(main.LogRotation{MaxSize: 10, MaxFiles: 2, Compress: true})
+	requireNoError(t, f.SetPath(path))
+
+	for _, line := range []string{"line 1\n", "line 2\n", "line 3\n", "line 4\n"} {
+		_, err := f.Write([]byte(line))
+		requireNoError(t, err)
+		// the rotated files are named by the time of the rotation
+		time.Sleep(2 * time.Millisecond)
+	}
+	requireNoError(t, f.Close())
+
+	files := readLogFiles(t, dir)
+	require.Equal(t, "line 4\n", files["service.log"])
+	delete(files, "service.log")
+	names := []string{}
+	for name := range files {
+		require.True(t, strings.HasPrefix(name, "service-") && strings.HasSuffix(name, ".log.gz"), name)
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	// only the newest rotated files are kept
+	require.Len(t, names, 2)
+	require.Equal(t, "line 2\n", files[names[0]])
+	require.Equal(t, "line 3\n", files[names[1]])
+
+	// a reopened log file is appended to and rotated by age
+	f = main.NewLogFile(main.LogRotation{})
+	requireNoError(t, f.SetPath(path))
+	_, err := f.Write([]byte("line 5\n"))
+	requireNoError(t, err)
+	f.SetRotation(main.LogRotation{MaxAge: time.Millisecond, MaxFiles: 1})
+	time.Sleep(2 * time.Millisecond)
+	_, err = f.Write([]byte("line 6\n"))
+	requireNoError(t, err)
+	requireNoError(t, f.Close())
+
+	files = readLogFiles(t, dir)
+	require.Len(t, files, 2)
+	require.Equal(t, "line 6\n", files["service.log"])
+	for name, data := range files {
+		if name != "service.log" {
+			require.Equal(t, "line 4\nline 5\n", data)
+		}
+	}
+}
+
+func TestLogFileMode(t *testing.T) {
+	CheckTestParallel(t)
+	if runtime.GOOS == "windows" {
+		t.Skip("windows has no file modes")
+	}
+
+	dir := filepath.Join(t.TempDir(), "logs")
+	path := filepath.Join(dir, "service.log")
+	requireMkdir(t, dir)
+	// a log file and a rotated file of an older version
+	oldBackup := filepath.Join(dir, "service-20240101T000000.000.log")
+	requireNoError(t, os.WriteFile(path, []byte("old\n"), 0o755))
+	requireNoError(t, os.WriteFile(oldBackup, []byte("older\n"), 0o755))
+	f := main.NewLogFile(main.LogRotation{MaxSize: 10, Compress: true})
+	requireNoError(t, f.SetPath(path))
+	_, err := f.Write([]byte("line 1\n"))
+	requireNoError(t, err)
+	requireNoError(t, f.Close())
+
+	entries, err := os.ReadDir(dir)
+	requireNoError(t, err)
+	require.Len(t, entries, 3)
+	for _, entry := range entries {
+		info, err := entry.Info()
+		requireNoError(t, err)
+		require.Equal(t, os.FileMode(0o600), info.Mode().Perm(), entry.Name())
+	}
+}
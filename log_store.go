@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultLogStoreSize is the number of log records kept for the gui
+const DefaultLogStoreSize = 20000
+
+// LogEntry is a log record of the LogStore
+type LogEntry struct {
+	// ID is the sequence number, set by the LogStore
+	ID        uint64
+	Time      time.Time
+	Level     slog.Level
+	Component string
+	Message   string
+	Attrs     []slog.Attr
+}
+
+// String formats the entry like the text log
+func (e LogEntry) String() string {
+	var buf bytes.Buffer
+	r := slog.NewRecord(e.Time, e.Level, e.Message, 0)
+	if e.Component != "" {
+		r.AddAttrs(slog.String(LogKeyComponent, e.Component))
+	}
+	r.AddAttrs(e.Attrs...)
+	_ = slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.Level(-1 << 10)}).Handle(context.Background(), r)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// LogStore keeps the newest log records in a ring buffer.
+// Every record gets a sequence number, that stays valid until the record is evicted.
+type LogStore struct {
+	m       sync.RWMutex
+	entries []LogEntry
+	// next is the sequence number of the next record, the record n is stored at n % len(entries)
+	next uint64
+
+	listenersMutex sync.Mutex
+	onChange       []func()
+}
+
+func NewLogStore(size int) *LogStore {
+	return &LogStore{
+		entries: make([]LogEntry, size),
+	}
+}
+
+func (s *LogStore) Add(e LogEntry) {
+	func() {
+		s.m.Lock()
+		defer s.m.Unlock()
+
+		e.ID = s.next
+		s.entries[s.next%uint64(len(s.entries))] = e
+		s.next++
+	}()
+
+	s.listenersMutex.Lock()
+	listeners := slices.Clone(s.onChange)
+	s.listenersMutex.Unlock()
+	for _, f := range listeners {
+		f()
+	}
+}
+
+func (s *LogStore) AddChangeEventListener(f func()) {
+	s.listenersMutex.Lock()
+	defer s.listenersMutex.Unlock()
+
+	s.onChange = append(s.onChange, f)
+}
+
+// Bounds returns the sequence numbers of the oldest kept record and of the next record
+func (s *LogStore) Bounds() (uint64, uint64) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	return s.first(), s.next
+}
+
+func (s *LogStore) first() uint64 {
+	if s.next < uint64(len(s.entries)) {
+		return 0
+	}
+	return s.next - uint64(len(s.entries))
+}
+
+// Get returns the record with the sequence number n, false if it got evicted or does not exist yet
+func (s *LogStore) Get(n uint64) (LogEntry, bool) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	if n < s.first() || n >= s.next {
+		return LogEntry{}, false
+	}
+	return s.entries[n%uint64(len(s.entries))], true
+}
+
+// LogFilter selects the records of a LogView
+type LogFilter struct {
+	// Level is the minimum level
+	Level slog.Level
+	// Text is searched case-insensitively in the formatted record, empty matches all
+	Text string
+}
+
+func (f LogFilter) Match(e LogEntry) bool {
+	if e.Level < f.Level {
+		return false
+	}
+	return f.Text == "" || strings.Contains(strings.ToLower(e.String()), strings.ToLower(f.Text))
+}
+
+// LogView is the filtered records of a LogStore, the oldest first. Update adds the new records.
+type LogView struct {
+	store *LogStore
+
+	m      sync.Mutex
+	filter LogFilter
+	// ids are the sequence numbers of the matching records
+	ids  []uint64
+	next uint64
+}
+
+func NewLogView(store *LogStore, filter LogFilter) *LogView {
+	v := &LogView{store: store}
+	v.SetFilter(filter)
+	return v
+}
+
+// SetFilter filters all kept records again
+func (v *LogView) SetFilter(filter LogFilter) {
+	v.m.Lock()
+	defer v.m.Unlock()
+
+	v.filter = filter
+	v.ids = nil
+	v.next, _ = v.store.Bounds()
+	v.update()
+}
+
+// Update drops the evicted records and adds the new matching ones
+func (v *LogView) Update() {
+	v.m.Lock()
+	defer v.m.Unlock()
+
+	v.update()
+}
+
+func (v *LogView) update() {
+	first, next := v.store.Bounds()
+	evicted, _ := slices.BinarySearch(v.ids, first)
+	if evicted > 0 {
+		// a new slice, so the evicted ids get reclaimed
+		v.ids = slices.Clone(v.ids[evicted:])
+	}
+	for n := max(v.next, first); n < next; n++ {
+		e, ok := v.store.Get(n)
+		if ok && v.filter.Match(e) {
+			v.ids = append(v.ids, n)
+		}
+	}
+	v.next = next
+}
+
+func (v *LogView) Len() int {
+	v.m.Lock()
+	defer v.m.Unlock()
+
+	return len(v.ids)
+}
+
+// Get returns the record at index i of the view, false if it got evicted since the last update
+func (v *LogView) Get(i int) (LogEntry, bool) {
+	v.m.Lock()
+	if i < 0 || i >= len(v.ids) {
+		v.m.Unlock()
+		return LogEntry{}, false
+	}
+	n := v.ids[i]
+	v.m.Unlock()
+
+	return v.store.Get(n)
+}
+
+// Export writes the records of the view with an ID from from to to (inclusive) as text lines
+func (v *LogView) Export(w io.Writer, from uint64, to uint64) error {
+	if from > to {
+		from, to = to, from
+	}
+	v.m.Lock()
+	start, _ := slices.BinarySearch(v.ids, from)
+	end, found := slices.BinarySearch(v.ids, to)
+	if found {
+		end++
+	}
+	ids := slices.Clone(v.ids[start:end])
+	v.m.Unlock()
+
+	for _, n := range ids {
+		e, ok := v.store.Get(n)
+		if !ok {
+			continue
+		}
+		_, err := fmt.Fprintln(w, e.String())
+		if err != nil {
+			return fmt.Errorf("error exporting log: %w", err)
+		}
+	}
+	return nil
+}
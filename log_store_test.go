@@ -0,0 +1,104 @@
+package main_test
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	main "github.com/anton15x/dropbox_ignore_service"
+	"github.com/stretchr/testify/require"
+)
+
+func addLogEntries(store *main.LogStore, from int, to int) {
+	for n := from; n < to; n++ {
+		level := slog.LevelInfo
+		if n%2 == 1 {
+			level = slog.LevelDebug
+		}
+		store.Add(main.LogEntry{
+			Time:      time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC),
+			Level:     level,
+			Component: main.LogComponentIgnorer,
+			Message:   fmt.Sprintf("record %d", n),
+			Attrs:     []slog.Attr{slog.Int("n", n)},
+		})
+	}
+}
+
+func TestLogStore(t *testing.T) {
+	CheckTestParallel(t)
+
+	store := main.NewLogStore(4)
+	addLogEntries(store, 0, 6)
+	first, next := store.Bounds()
+	require.Equal(t, uint64(2), first)
+	require.Equal(t, uint64(6), next)
+	_, ok := store.Get(1)
+	require.False(t, ok)
+	_, ok = store.Get(6)
+	require.False(t, ok)
+	e, ok := store.Get(5)
+	require.True(t, ok)
+	require.Equal(t, uint64(5), e.ID)
+	require.Equal(t, `time=2026-01-02T15:04:05.000Z level=DEBUG msg="record 5" component=ignorer n=5`, e.String())
+
+	// concurrent writers
+	store = main.NewLogStore(100)
+	var wg sync.WaitGroup
+	for n := 0; n < 10; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			addLogEntries(store, 0, 50)
+		}()
+	}
+	wg.Wait()
+	first, next = store.Bounds()
+	require.Equal(t, uint64(400), first)
+	require.Equal(t, uint64(500), next)
+}
+
+func TestLogView(t *testing.T) {
+	CheckTestParallel(t)
+
+	store := main.NewLogStore(10)
+	addLogEntries(store, 0, 8)
+	view := main.NewLogView(store, main.LogFilter{Level: slog.LevelInfo})
+	require.Equal(t, 4, view.Len())
+	e, ok := view.Get(1)
+	require.True(t, ok)
+	require.Equal(t, "record 2", e.Message)
+
+	// the view keeps its records until it is updated
+	addLogEntries(store, 8, 14)
+	require.Equal(t, 4, view.Len())
+	view.Update()
+	require.Equal(t, 5, view.Len())
+	e, ok = view.Get(0)
+	require.True(t, ok)
+	require.Equal(t, "record 4", e.Message)
+
+	view.SetFilter(main.LogFilter{Level: slog.LevelDebug, Text: "RECORD 1"})
+	require.Equal(t, 4, view.Len())
+
+	var out strings.Builder
+	requireNoError(t, view.Export(&out, 12, 10))
+	require.Equal(t, "record 10\nrecord 11\nrecord 12\n", exportedMessages(t, out.String()))
+	out.Reset()
+	requireNoError(t, view.Export(&out, 0, 100))
+	require.Equal(t, "record 10\nrecord 11\nrecord 12\nrecord 13\n", exportedMessages(t, out.String()))
+}
+
+func exportedMessages(t *testing.T, exported string) string {
+	messages := ""
+	for _, line := range strings.Split(strings.TrimSuffix(exported, "\n"), "\n") {
+		_, msg, found := strings.Cut(line, `msg="`)
+		require.True(t, found, line)
+		msg, _, _ = strings.Cut(msg, `"`)
+		messages += msg + "\n"
+	}
+	return messages
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync/atomic"
+)
+
+// the attribute keys of the log records
+const (
+	LogKeyComponent = "component"
+	LogKeyRoot      = "root"
+	LogKeyPath      = "path"
+	LogKeyRule      = "rule"
+	LogKeyOp        = "op"
+	LogKeyError     = "err"
+)
+
+// the components, that log with their own level
+const (
+	LogComponentMain    = "main"
+	LogComponentManager = "manager"
+	LogComponentIgnorer = "ignorer"
+	LogComponentWatcher = "watcher"
+	LogComponentControl = "control"
+	LogComponentConfig  = "config"
+	LogComponentGUI     = "gui"
+	LogComponentPlan    = "plan"
+	LogComponentLock    = "lock"
+)
+
+var LogComponents = []string{
+	LogComponentMain,
+	LogComponentManager,
+	LogComponentIgnorer,
+	LogComponentWatcher,
+	LogComponentControl,
+	LogComponentConfig,
+	LogComponentGUI,
+	LogComponentPlan,
+	LogComponentLock,
+}
+
+type LogFormat string
+
+const (
+	LogFormatText LogFormat = "text"
+	LogFormatJSON LogFormat = "json"
+)
+
+func ParseLogFormat(s string) (LogFormat, error) {
+	switch LogFormat(s) {
+	case LogFormatText, LogFormatJSON:
+		return LogFormat(s), nil
+	default:
+		return "", fmt.Errorf("unknown log format %q, expected %s or %s", s, LogFormatText, LogFormatJSON)
+	}
+}
+
+// LogLevels are the level of all components and the overrides of single components
+type LogLevels struct {
+	Default    slog.Level
+	Components map[string]slog.Level
+}
+
+// ParseLogLevels parses a level with optional component overrides, e.g. "info" or "warn,ignorer=debug,gui=error"
+func ParseLogLevels(s string) (LogLevels, error) {
+	levels := LogLevels{Components: map[string]slog.Level{}}
+	for n, part := range strings.Split(s, ",") {
+		component, levelName, isOverride := strings.Cut(strings.TrimSpace(part), "=")
+		if !isOverride {
+			levelName = component
+		}
+		var level slog.Level
+		err := level.UnmarshalText([]byte(levelName))
+		if err != nil {
+			return LogLevels{}, fmt.Errorf("invalid log level %q: %w", levelName, err)
+		}
+		switch {
+		case isOverride && !slices.Contains(LogComponents, component):
+			return LogLevels{}, fmt.Errorf("unknown log component %q, expected one of %s", component, strings.Join(LogComponents, ", "))
+		case isOverride:
+			levels.Components[component] = level
+		case n == 0:
+			levels.Default = level
+		default:
+			return LogLevels{}, fmt.Errorf("the level of all components must be first: %q", s)
+		}
+	}
+	return levels, nil
+}
+
+func (l LogLevels) level(component string) slog.Level {
+	if level, ok := l.Components[component]; ok {
+		return level
+	}
+	return l.Default
+}
+
+// LogOptions are shared by the loggers of NewLogger, they can change while the service runs
+type LogOptions struct {
+	json   atomic.Bool
+	levels atomic.Pointer[LogLevels]
+}
+
+func NewLogOptions(format LogFormat, levels LogLevels) *LogOptions {
+	o := &LogOptions{}
+	o.SetFormat(format)
+	o.SetLevels(levels)
+	return o
+}
+
+func (o *LogOptions) SetFormat(format LogFormat) {
+	o.json.Store(format == LogFormatJSON)
+}
+func (o *LogOptions) SetLevels(levels LogLevels) {
+	o.levels.Store(&levels)
+}
+
+// NewLogger writes the records of the enabled levels to w and store (may be nil), the component attribute selects the level
+func NewLogger(w io.Writer, options *LogOptions, store *LogStore) *slog.Logger {
+	// the level is checked by Enabled of logHandler
+	handlerOptions := &slog.HandlerOptions{Level: slog.Level(-1 << 10)}
+	return slog.New(&logHandler{
+		options: options,
+		store:   store,
+		text:    slog.NewTextHandler(w, handlerOptions),
+		json:    slog.NewJSONHandler(w, handlerOptions),
+	})
+}
+
+// logHandler keeps the text and the json handler with the same attributes, so the format can change at any time
+type logHandler struct {
+	options   *LogOptions
+	component string
+	text      slog.Handler
+	json      slog.Handler
+
+	store *LogStore
+	// attrs and groups are kept for the records of the store
+	attrs  []slog.Attr
+	groups []string
+}
+
+func (h *logHandler) handler() slog.Handler {
+	if h.options.json.Load() {
+		return h.json
+	}
+	return h.text
+}
+
+func (h *logHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.options.levels.Load().level(h.component)
+}
+
+func (h *logHandler) Handle(ctx context.Context, r slog.Record) error {
+	if h.store != nil {
+		h.store.Add(h.entry(r))
+	}
+	return h.handler().Handle(ctx, r)
+}
+
+func (h *logHandler) entry(r slog.Record) LogEntry {
+	e := LogEntry{
+		Time:      r.Time,
+		Level:     r.Level,
+		Component: h.component,
+		Message:   r.Message,
+		Attrs:     make([]slog.Attr, 0, len(h.attrs)+r.NumAttrs()),
+	}
+	e.Attrs = append(e.Attrs, h.attrs...)
+	r.Attrs(func(attr slog.Attr) bool {
+		e.Attrs = append(e.Attrs, h.groupAttr(attr))
+		return true
+	})
+	return e
+}
+
+// groupAttr prefixes the key with the groups, like the text handler
+func (h *logHandler) groupAttr(attr slog.Attr) slog.Attr {
+	if len(h.groups) > 0 {
+		attr.Key = strings.Join(h.groups, ".") + "." + attr.Key
+	}
+	return attr
+}
+
+func (h *logHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := *h
+	c.attrs = slices.Clip(h.attrs)
+	for _, attr := range attrs {
+		if attr.Key == LogKeyComponent && len(h.groups) == 0 {
+			c.component = attr.Value.String()
+			continue
+		}
+		c.attrs = append(c.attrs, h.groupAttr(attr))
+	}
+	c.text = h.text.WithAttrs(attrs)
+	c.json = h.json.WithAttrs(attrs)
+	return &c
+}
+
+func (h *logHandler) WithGroup(name string) slog.Handler {
+	c := *h
+	c.groups = append(slices.Clip(h.groups), name)
+	c.text = h.text.WithGroup(name)
+	c.json = h.json.WithGroup(name)
+	return &c
+}
+
+// componentLogger returns the logger of a component
+func componentLogger(logger *slog.Logger, component string) *slog.Logger {
+	return logger.With(LogKeyComponent, component)
+}
@@ -0,0 +1,73 @@
+package main_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	main "github.com/anton15x/dropbox_ignore_service"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLogLevels(t *testing.T) {
+	CheckTestParallel(t)
+
+	levels, err := main.ParseLogLevels("warn, ignorer=debug,gui=ERROR")
+	requireNoError(t, err)
+	require.Equal(t, main.LogLevels{
+		Default: slog.LevelWarn,
+		Components: map[string]slog.Level{
+			main.LogComponentIgnorer: slog.LevelDebug,
+			main.LogComponentGUI:     slog.LevelError,
+		},
+	}, levels)
+
+	for _, s := range []string{"", "loud", "ignorer=debug,info", "unknown=debug", "gui=loud"} {
+		_, err := main.ParseLogLevels(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestLogger(t *testing.T) {
+	CheckTestParallel(t)
+
+	levels, err := main.ParseLogLevels("info,ignorer=debug,control=error")
+	requireNoError(t, err)
+	options := main.NewLogOptions(main.LogFormatJSON, levels)
+	var out bytes.Buffer
+	store := main.NewLogStore(10)
+	logger := main.NewLogger(&out, options, store)
+
+	ignorer := logger.With(main.LogKeyComponent, main.LogComponentIgnorer, main.LogKeyRoot, "/dropbox")
+	ignorer.Debug("got event", main.LogKeyOp, "CREATE", main.LogKeyPath, "/dropbox/a")
+	logger.With(main.LogKeyComponent, main.LogComponentControl).Info("dropped")
+	logger.Debug("dropped")
+	var record map[string]any
+	requireNoError(t, json.Unmarshal(out.Bytes(), &record))
+	require.Equal(t, "got event", record["msg"])
+	require.Equal(t, main.LogComponentIgnorer, record[main.LogKeyComponent])
+	require.Equal(t, "/dropbox", record[main.LogKeyRoot])
+	require.Equal(t, "/dropbox/a", record[main.LogKeyPath])
+	require.Equal(t, "CREATE", record[main.LogKeyOp])
+
+	// the options apply to the existing loggers
+	out.Reset()
+	options.SetFormat(main.LogFormatText)
+	options.SetLevels(main.LogLevels{Default: slog.LevelInfo})
+	ignorer.Debug("dropped")
+	ignorer.Info("ignoring path", main.LogKeyPath, "/dropbox/node_modules")
+	require.Contains(t, out.String(), `level=INFO msg="ignoring path" component=ignorer root=/dropbox path=/dropbox/node_modules`)
+	require.NotContains(t, out.String(), "dropped")
+
+	// the store gets the structured records of the enabled levels
+	first, next := store.Bounds()
+	require.Equal(t, uint64(0), first)
+	require.Equal(t, uint64(2), next)
+	e, ok := store.Get(1)
+	require.True(t, ok)
+	require.Equal(t, slog.LevelInfo, e.Level)
+	require.Equal(t, main.LogComponentIgnorer, e.Component)
+	require.Equal(t, "ignoring path", e.Message)
+	require.Equal(t, []slog.Attr{slog.String(main.LogKeyRoot, "/dropbox"), slog.String(main.LogKeyPath, "/dropbox/node_modules")}, e.Attrs)
+}
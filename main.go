@@ -2,28 +2,44 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"os"
-	"os/signal"
 	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
 	"sync"
-	"syscall"
+	"time"
+
+	"github.com/anton15x/dropbox_ignore_service/src/fsnotify"
 )
 
-func getDropboxFoldersEnsured(cmdFolders []string) ([]string, error) {
+func getDropboxFoldersEnsured(cmdFolders []string, accountType string) ([]string, error) {
 	if len(cmdFolders) > 0 {
 		return cmdFolders, nil
 	}
 
-	folders, err := ParseDropboxInfoPaths()
+	accounts, err := ParseDropboxAccounts()
+	if err != nil {
+		return nil, fmt.Errorf("error parsing dropbox folders: %w", err)
+	}
+	accounts, err = FilterDropboxAccounts(accounts, accountType)
 	if err != nil {
-		return nil, fmt.Errorf("error parsing dropbox folders: %s", err)
+		return nil, withExitCode(ExitUsage, err)
+	}
+	if len(accounts) == 0 {
+		if accountType != "" {
+			return nil, withExitCode(ExitNoDropboxFolder, fmt.Errorf("could not find dropbox folder of %s account", accountType))
+		}
+		return nil, withExitCode(ExitNoDropboxFolder, fmt.Errorf("could not find dropbox folders"))
 	}
-	if len(folders) == 0 {
-		return nil, fmt.Errorf("could not find dropbox folders")
+	folders := make([]string, len(accounts))
+	for i, account := range accounts {
+		folders[i] = account.Path
 	}
 	return folders, nil
 }
@@ -38,12 +54,44 @@ func (i *stringArrayFlags) Set(value string) error {
 	return nil
 }
 
+func printAlreadyUploadedReport(w io.Writer, alreadyUploadedSet *RootAwareSet) error {
+	if alreadyUploadedSet.Len() == 0 {
+		_, err := fmt.Fprintln(w, "no ignored path is already uploaded")
+		return err
+	}
+	_, err := fmt.Fprintln(w, "ignored but already uploaded — delete them from dropbox.com to reclaim space:")
+	if err != nil {
+		return err
+	}
+	for _, root := range alreadyUploadedSet.Roots() {
+		paths := alreadyUploadedSet.RootSet(root).Values()
+		if len(paths) == 0 {
+			continue
+		}
+		_, err = fmt.Fprintf(w, "%s (%d paths):\n", root, len(paths))
+		if err != nil {
+			return err
+		}
+		for _, path := range paths {
+			_, err = fmt.Fprintf(w, "  %s\n", path)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 func main() {
 	err := mainWithErrPanicWrapped()
 	if err != nil {
-		ShowError(err.Error())
-		log.Fatal(err.Error())
-		os.Exit(1)
+		if isServiceCommand(os.Args[1:]) {
+			ShowError(err.Error())
+			slog.Error(err.Error())
+		} else {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(ExitCode(err))
 	}
 }
 
@@ -58,114 +106,442 @@ func mainWithErrPanicWrapped() (retErr error) {
 
 	err := mainWithErr()
 	if err != nil {
-		retErr = fmt.Errorf("errored: %s", err)
+		retErr = fmt.Errorf("errored: %w", err)
 	}
 	panicked = false
 	return
 }
 
+// instanceStartTimeout is the time a second launch waits for the initial walk of the running service
+const instanceStartTimeout = 5 * time.Minute
+
+// handOffToRunningInstance forwards a second launch to the running service, that shows its window
+func handOffToRunningInstance(pausedDropboxFolders []string, hideGUI bool, logger *slog.Logger) error {
+	client, info, err := DialRunningInstance(InstanceLockPath(), instanceStartTimeout)
+	if err != nil {
+		return withExitCode(ExitAlreadyRunning, fmt.Errorf("%w, error connecting to it: %w", ErrInstanceRunning, err))
+	}
+	defer client.Close()
+
+	if len(pausedDropboxFolders) > 0 {
+		_, err = client.Pause(ControlArgs{Roots: pausedDropboxFolders})
+		if err != nil {
+			return withExitCode(ExitAlreadyRunning, fmt.Errorf("error pausing dropbox folders of the running instance: %w", err))
+		}
+	}
+	if hideGUI {
+		logger.Info("another instance is running, exiting", "pid", info.PID)
+		return nil
+	}
+	shown, err := client.ShowWindow(ControlArgs{})
+	if err != nil {
+		return withExitCode(ExitAlreadyRunning, fmt.Errorf("error showing window of the running instance: %w", err))
+	}
+	if !shown {
+		logger.Info("another instance is running without window, exiting", "pid", info.PID)
+		return nil
+	}
+	logger.Info("another instance is running, showed its window", "pid", info.PID)
+	return nil
+}
+
 func mainWithErr() error {
+	return RunCommand(os.Args[1:], os.Stdout)
+}
+
+// runService watches the dropbox folders until ctx is done or the gui exits
+func runService(ctx context.Context, args []string) error {
 	var err error
 	var logFilename string
 	var dropboxFolders stringArrayFlags
 	var tryRun bool
 	var hideGUI bool
+	var watcherBackendName string
+	var pollInterval time.Duration
+	var pollingDropboxFolders stringArrayFlags
+	var uploadedReport bool
+	var accountType string
+	var pausedDropboxFolders stringArrayFlags
+	var reconcileInterval time.Duration
+	var reconcileFix bool
+	var controlSocket string
+	var configPath string
+	var logFormatName string
+	var logLevelsText string
+	var logMaxSize int
+	var logMaxAge time.Duration
+	var logMaxFiles int
+	var logCompress bool
+	var autoStarted bool
 
 	const hideGUIArg = "hide-gui"
-	const tryRunArg = "f"
+	const tryRunArg = "t"
 	const dropboxFolderArg = "f"
 	const logFilenameArg = "log"
+	const watcherBackendArg = "watcher"
+	const pollIntervalArg = "poll-interval"
+	const pollingDropboxFolderArg = "poll"
+	const uploadedReportArg = "uploaded-report"
+	const accountArg = "account"
+	const pausedDropboxFolderArg = "pause"
+	const reconcileIntervalArg = "reconcile-interval"
+	const reconcileFixArg = "reconcile-fix"
+	const controlSocketArg = "socket"
+	const configPathArg = "config"
+	const logFormatArg = "log-format"
+	const logLevelArg = "log-level"
+	const logMaxSizeArg = "log-max-size"
+	const logMaxAgeArg = "log-max-age"
+	const logMaxFilesArg = "log-max-files"
+	const logCompressArg = "log-compress"
+	const autoStartedArg = "autostart"
 	flag.StringVar(&logFilename, logFilenameArg, "", "The log file location (default: no file logging)")
 	flag.Var(&dropboxFolders, dropboxFolderArg, "the path to the dropbox root folder, may be specified multiple times (skips reading dropbox config file)")
 	flag.BoolVar(&hideGUI, hideGUIArg, false, "If true, the GUI will not get shown at start (used at autostart with the operation system)")
-	flag.BoolVar(&tryRun, "t", false, "A try run (does only prints the files, that would get ignored)")
-	flag.Parse()
+	flag.BoolVar(&tryRun, tryRunArg, false, "A try run (does only prints the files, that would get ignored)")
+	flag.StringVar(&watcherBackendName, watcherBackendArg, string(fsnotify.BackendAuto), "The file watcher backend: auto, native or polling (auto uses polling for network/FUSE filesystems or if the inotify watch limit is reached)")
+	flag.DurationVar(&pollInterval, pollIntervalArg, fsnotify.DefaultPollInterval, "The interval between two directory snapshots of the polling file watcher")
+	flag.Var(&pollingDropboxFolders, pollingDropboxFolderArg, "the path to a dropbox root folder that should always use the polling file watcher, may be specified multiple times")
+	flag.BoolVar(&uploadedReport, uploadedReportArg, false, "Prints the ignored paths, that dropbox already uploaded before they got flagged, and exits without changing any flag")
+	flag.StringVar(&accountType, accountArg, "", "Only handle the dropbox folder of this account: personal or business (default: all accounts of the dropbox config file)")
+	flag.Var(&pausedDropboxFolders, pausedDropboxFolderArg, "the path to a dropbox root folder that should start paused (no flag gets changed until it is resumed in the gui), may be specified multiple times")
+	flag.DurationVar(&reconcileInterval, reconcileIntervalArg, DefaultReconcileInterval, "The interval between two walks, that compare the ignore flags with the ignore rules (0 disables them)")
+	flag.BoolVar(&reconcileFix, reconcileFixArg, false, "If true, the reconcile walks set the missing ignore flags")
+	flag.StringVar(&controlSocket, controlSocketArg, ControlSocketPath(), "The unix socket of the control api, that the commands use (empty disables it)")
+	flag.StringVar(&configPath, configPathArg, ConfigPath(), "The config file, the other flags override its settings (empty disables it)")
+	flag.StringVar(&logFormatName, logFormatArg, string(LogFormatText), "The format of the log: text or json")
+	flag.StringVar(&logLevelsText, logLevelArg, "info", "The log level: debug, info, warn or error, followed by the overrides of single components, e.g. info,ignorer=debug,gui=warn")
+	flag.IntVar(&logMaxSize, logMaxSizeArg, DefaultLogMaxSize, "The size in MB, before the log file is rotated (0 disables it)")
+	flag.DurationVar(&logMaxAge, logMaxAgeArg, DefaultLogMaxAge, "The duration the log file is written to, before it is rotated (0 disables it)")
+	flag.IntVar(&logMaxFiles, logMaxFilesArg, DefaultLogMaxFiles, "The number of rotated log files, that are kept (0 keeps all)")
+	flag.BoolVar(&logCompress, logCompressArg, false, "If true, the rotated log files get gzipped")
+	flag.BoolVar(&autoStarted, autoStartedArg, false, "Set by the autostart entry, logs to "+DefaultLogPath()+" if no log file is set")
+	err = flag.CommandLine.Parse(args)
+	if err != nil {
+		return withExitCode(ExitUsage, err)
+	}
+	// only the given flags override the config file
+	setFlags := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		setFlags[f.Name] = true
+	})
+
+	watcherBackend, err := fsnotify.ParseBackend(watcherBackendName)
+	if err != nil {
+		return withExitCode(ExitUsage, err)
+	}
+	_, err = FilterDropboxAccounts(nil, accountType)
+	if err != nil {
+		return withExitCode(ExitUsage, err)
+	}
+	if accountType != "" && len(dropboxFolders) > 0 {
+		return withExitCode(ExitUsage, fmt.Errorf("-%s can not be combined with -%s", accountArg, dropboxFolderArg))
+	}
+	logFormat, err := ParseLogFormat(logFormatName)
+	if err != nil {
+		return withExitCode(ExitUsage, err)
+	}
+	_, err = ParseLogLevels(logLevelsText)
+	if err != nil {
+		return withExitCode(ExitUsage, err)
+	}
+
+	if logMaxSize < 0 || logMaxAge < 0 || logMaxFiles < 0 {
+		return withExitCode(ExitUsage, fmt.Errorf("-%s, -%s and -%s must not be negative", logMaxSizeArg, logMaxAgeArg, logMaxFilesArg))
+	}
 
 	if logFilename != "" {
 		absPath, err := filepath.Abs(logFilename)
 		if err != nil {
-			log.Fatalf("error getting abs path of %s: %s", logFilename, err)
+			return fmt.Errorf("error getting abs path of %s: %w", logFilename, err)
 		}
 		logFilename = absPath
-		logFile, err := os.OpenFile(logFilename, os.O_RDWR|os.O_CREATE|os.O_APPEND, os.ModePerm)
+	}
+	for i, dropboxFolder := range dropboxFolders {
+		absPath, err := filepath.Abs(dropboxFolder)
 		if err != nil {
-			log.Fatalf("Error open log file %s: %s", logFilename, err)
+			return fmt.Errorf("error getting abs path of %s: %w", dropboxFolder, err)
 		}
-		defer func() {
-			err = logFile.Close()
-			if err != nil {
-				log.Printf("error closing log file: %s", err)
-			}
-		}()
-		bakWriter := log.Writer()
-		defer log.SetOutput(bakWriter)
-		log.SetOutput(io.MultiWriter(logFile, bakWriter))
+		dropboxFolders[i] = absPath
 	}
-
-	logStringSlice := NewLogStringSlice()
-	{
-		bakWriter := log.Writer()
-		defer log.SetOutput(bakWriter)
-		log.SetOutput(io.MultiWriter(logStringSlice, bakWriter))
+	for i, dropboxFolder := range pollingDropboxFolders {
+		absPath, err := filepath.Abs(dropboxFolder)
+		if err != nil {
+			return fmt.Errorf("error getting abs path of %s: %w", dropboxFolder, err)
+		}
+		pollingDropboxFolders[i] = absPath
 	}
-
-	for i, dropboxFolder := range dropboxFolders {
+	for i, dropboxFolder := range pausedDropboxFolders {
 		absPath, err := filepath.Abs(dropboxFolder)
 		if err != nil {
-			log.Fatalf("error getting abs path of %s: %s", dropboxFolder, err)
+			return fmt.Errorf("error getting abs path of %s: %w", dropboxFolder, err)
 		}
-		dropboxFolders[i] = absPath
+		pausedDropboxFolders[i] = absPath
 	}
 
-	args := []string{}
-	for _, dropboxFolder := range dropboxFolders {
-		args = append(args, "-"+dropboxFolderArg, dropboxFolder)
+	if controlSocket != "" {
+		controlSocket, err = filepath.Abs(controlSocket)
+		if err != nil {
+			return fmt.Errorf("error getting abs path of %s: %w", controlSocket, err)
+		}
 	}
-	args = append(args, "-"+hideGUIArg)
-	if tryRun {
-		args = append(args, "-"+tryRunArg)
+	if configPath != "" {
+		configPath, err = filepath.Abs(configPath)
+		if err != nil {
+			return fmt.Errorf("error getting abs path of %s: %w", configPath, err)
+		}
 	}
-	if logFilename != "" {
-		args = append(args, "-"+logFilenameArg, logFilename)
+
+	overrides := func(c *Config) {
+		if setFlags[dropboxFolderArg] {
+			c.Roots = slices.Clone(dropboxFolders)
+			c.Account = ""
+		}
+		if setFlags[accountArg] {
+			c.Account = accountType
+			c.Roots = nil
+		}
+		if setFlags[tryRunArg] {
+			c.TryRun = tryRun
+		}
+		if setFlags[logFilenameArg] {
+			c.Log.File = logFilename
+		}
+		if setFlags[logFormatArg] {
+			c.Log.Format = string(logFormat)
+		}
+		if setFlags[logLevelArg] {
+			c.Log.Level = logLevelsText
+		}
+		if setFlags[logMaxSizeArg] {
+			c.Log.MaxSize = logMaxSize
+		}
+		if setFlags[logMaxAgeArg] {
+			c.Log.MaxAge = Duration(logMaxAge)
+		}
+		if setFlags[logMaxFilesArg] {
+			c.Log.MaxFiles = logMaxFiles
+		}
+		if setFlags[logCompressArg] {
+			c.Log.Compress = logCompress
+		}
+		if autoStarted && c.Log.File == "" {
+			// nobody sees stderr of the autostarted service
+			c.Log.File = DefaultLogPath()
+		}
+		if setFlags[watcherBackendArg] {
+			c.Watcher.Backend = string(watcherBackend)
+		}
+		if setFlags[pollIntervalArg] {
+			c.Watcher.PollInterval = Duration(pollInterval)
+		}
+		if setFlags[pollingDropboxFolderArg] {
+			c.Watcher.PollRoots = slices.Clone(pollingDropboxFolders)
+		}
+		if setFlags[reconcileIntervalArg] {
+			c.Reconcile.Interval = Duration(reconcileInterval)
+		}
+		if setFlags[reconcileFixArg] {
+			c.Reconcile.Fix = reconcileFix
+		}
+		if uploadedReport {
+			// the report only needs the initial walk, it must not change any flag
+			c.TryRun = true
+		}
+	}
+	config, err := NewConfigStore(configPath, overrides)
+	if err != nil {
+		return withExitCode(ExitUsage, err)
+	}
+
+	logFile := NewLogFile(config.Config().Log.Rotation())
+	err = logFile.SetPath(config.Config().Log.File)
+	if err != nil {
+		return err
+	}
+	logStore := NewLogStore(DefaultLogStoreSize)
+	// validated by the config store
+	logLevels, _ := ParseLogLevels(config.Config().Log.Level)
+	logOptions := NewLogOptions(LogFormat(config.Config().Log.Format), logLevels)
+	logger := NewLogger(io.MultiWriter(logFile, os.Stderr), logOptions, logStore)
+	// the gui and the log package of other libraries use the default logger
+	slog.SetDefault(logger)
+	mainLogger := componentLogger(logger, LogComponentMain)
+	defer func() {
+		err := logFile.Close()
+		if err != nil {
+			mainLogger.Error("closing log file failed", LogKeyError, err)
+		}
+	}()
+
+	// the settings of the config file are not baked into the autostart entry, a change applies without re-enabling it
+	autoStartArgs := []string{}
+	if setFlags[dropboxFolderArg] {
+		for _, dropboxFolder := range dropboxFolders {
+			autoStartArgs = append(autoStartArgs, "-"+dropboxFolderArg, dropboxFolder)
+		}
+	}
+	autoStartArgs = append(autoStartArgs, "-"+hideGUIArg, "-"+autoStartedArg)
+	if setFlags[tryRunArg] {
+		autoStartArgs = append(autoStartArgs, fmt.Sprintf("-%s=%t", tryRunArg, tryRun))
+	}
+	if setFlags[logFilenameArg] {
+		autoStartArgs = append(autoStartArgs, "-"+logFilenameArg, logFilename)
+	}
+	if setFlags[logFormatArg] {
+		autoStartArgs = append(autoStartArgs, "-"+logFormatArg, string(logFormat))
+	}
+	if setFlags[logLevelArg] {
+		autoStartArgs = append(autoStartArgs, "-"+logLevelArg, logLevelsText)
+	}
+	if setFlags[logMaxSizeArg] {
+		autoStartArgs = append(autoStartArgs, "-"+logMaxSizeArg, strconv.Itoa(logMaxSize))
+	}
+	if setFlags[logMaxAgeArg] {
+		autoStartArgs = append(autoStartArgs, "-"+logMaxAgeArg, logMaxAge.String())
+	}
+	if setFlags[logMaxFilesArg] {
+		autoStartArgs = append(autoStartArgs, "-"+logMaxFilesArg, strconv.Itoa(logMaxFiles))
+	}
+	if setFlags[logCompressArg] {
+		autoStartArgs = append(autoStartArgs, fmt.Sprintf("-%s=%t", logCompressArg, logCompress))
+	}
+	if setFlags[watcherBackendArg] {
+		autoStartArgs = append(autoStartArgs, "-"+watcherBackendArg, string(watcherBackend))
+	}
+	if setFlags[pollIntervalArg] {
+		autoStartArgs = append(autoStartArgs, "-"+pollIntervalArg, pollInterval.String())
+	}
+	if setFlags[pollingDropboxFolderArg] {
+		for _, dropboxFolder := range pollingDropboxFolders {
+			autoStartArgs = append(autoStartArgs, "-"+pollingDropboxFolderArg, dropboxFolder)
+		}
+	}
+	if setFlags[accountArg] {
+		autoStartArgs = append(autoStartArgs, "-"+accountArg, accountType)
+	}
+	if setFlags[reconcileIntervalArg] {
+		autoStartArgs = append(autoStartArgs, "-"+reconcileIntervalArg, reconcileInterval.String())
+	}
+	if setFlags[reconcileFixArg] {
+		autoStartArgs = append(autoStartArgs, fmt.Sprintf("-%s=%t", reconcileFixArg, reconcileFix))
+	}
+	if controlSocket != ControlSocketPath() {
+		autoStartArgs = append(autoStartArgs, "-"+controlSocketArg, controlSocket)
+	}
+	if configPath != ConfigPath() {
+		autoStartArgs = append(autoStartArgs, "-"+configPathArg, configPath)
+	}
+	SetAutoStartArgs(autoStartArgs)
+
+	if !uploadedReport {
+		// the report never changes a flag, it may run next to the service
+		lock, err := AcquireInstanceLock(InstanceLockPath(), InstanceInfo{PID: os.Getpid(), Socket: controlSocket, Started: time.Now()}, logger)
+		if errors.Is(err, ErrInstanceRunning) {
+			return handOffToRunningInstance(pausedDropboxFolders, hideGUI, mainLogger)
+		}
+		if err != nil {
+			return err
+		}
+		// released after the ignorers stopped
+		defer func() {
+			err := lock.Release()
+			if err != nil {
+				mainLogger.Error("releasing instance lock failed", LogKeyError, err)
+			}
+		}()
 	}
-	SetAutoStartArgs(args)
 
 	var wg sync.WaitGroup
-	// TODO: fyne package seems hide signals from us
-	// ctx, ctxStop := context.WithCancel(context.Background())
-	ctx, ctxStop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	ctx, ctxStop := context.WithCancel(ctx)
 	defer func() {
 		ctxStop()
 		wg.Wait()
 	}()
 
-	dropboxFolders, err = getDropboxFoldersEnsured(dropboxFolders)
+	// no dropbox folder is only fatal at start
+	_, err = getDropboxFoldersEnsured(config.Config().Roots, config.Config().Account)
+	if err != nil {
+		return err
+	}
+	findRoots := func() ([]string, error) {
+		c := config.Config()
+		roots, err := getDropboxFoldersEnsured(c.Roots, c.Account)
+		if ExitCode(err) == ExitNoDropboxFolder || errors.Is(err, ErrNoDropboxInfoFile) {
+			// the last account got unlinked, its dropbox ignorer is stopped
+			return nil, nil
+		}
+		return roots, err
+	}
+
+	ignorerOptions := func(root string) IgnorerOptions {
+		return config.Config().IgnorerOptions(root)
+	}
+	manager := NewRootManager(ctx, &wg, logger, NewEventBus(), findRoots, ignorerOptions)
+	if !uploadedReport {
+		// the report never changes a flag, but it needs the initial walk
+		manager.SetStartPaused(pausedDropboxFolders...)
+	}
+	err = manager.Sync()
 	if err != nil {
 		return err
 	}
-	log.Printf("handling dropbox folders: %+v", dropboxFolders)
+	mainLogger.Info("handling dropbox folders", "roots", manager.IgnoredPathsSet().Roots())
 
-	ignoredPathsSet := NewSortedStringSet()
-	ignoreFilesSet := NewSortedStringSet()
-	dropboxIgnorers := make([]*DropboxIgnorer, len(dropboxFolders))
+	if uploadedReport {
+		return printAlreadyUploadedReport(os.Stdout, manager.AlreadyUploadedSet())
+	}
+	// the dropbox folders of the dropbox config file may change while running
+	manager.Watch(RootsCheckInterval)
+	manager.SetReconcileFix(config.Config().Reconcile.Fix)
+	manager.ReconcileEvery(time.Duration(config.Config().Reconcile.Interval))
+	config.AddChangeEventListener(func(old Config, new Config) {
+		applyConfigChange(manager, logFile, logOptions, mainLogger, old, new)
+	})
+	config.Watch(ctx, &wg, ConfigCheckInterval, logger)
 
-	for i, dropboxFolder := range dropboxFolders {
-		ignorer, err := NewDropboxIgnorer(dropboxFolder, tryRun, log.Default(), ctx, &wg, ignoredPathsSet, ignoreFilesSet)
+	var control *ControlService
+	if controlSocket != "" {
+		control, err = ServeControl(ctx, &wg, controlSocket, manager, config, logger)
 		if err != nil {
-			return fmt.Errorf("error creating dropbox ignorer for %s: %w", dropboxFolder, err)
+			// the dropbox folders are handled anyway, only the commands fall back to scanning
+			mainLogger.Error("starting control api failed", LogKeyError, err)
 		}
-		dropboxIgnorers[i] = ignorer
-
-		log.Printf("listening for events in dropbox %s", dropboxFolder)
-		ignorer.ListenForEvents()
 	}
 
-	err = ShowGUI(ctx, dropboxIgnorers, hideGUI, ignoredPathsSet, ignoreFilesSet, logStringSlice)
+	err = ShowGUI(ctx, manager, control, config, hideGUI, logStore)
 	if err != nil {
 		return fmt.Errorf("error showing gui: %w", err)
 	}
-	log.Printf("gui exited")
+	mainLogger.Info("gui exited")
 
 	return nil
 
 }
+
+// applyConfigChange applies a reloaded config to the running service
+func applyConfigChange(manager *RootManager, logFile *LogFile, logOptions *LogOptions, logger *slog.Logger, old Config, new Config) {
+	logger.Info("config changed, applying it")
+	logFile.SetRotation(new.Log.Rotation())
+	err := logFile.SetPath(new.Log.File)
+	if err != nil {
+		logger.Error("changing log file failed", LogKeyError, err)
+	}
+	// validated by the config store
+	logOptions.SetFormat(LogFormat(new.Log.Format))
+	logLevels, _ := ParseLogLevels(new.Log.Level)
+	logOptions.SetLevels(logLevels)
+	manager.SetReconcileFix(new.Reconcile.Fix)
+	if new.Reconcile.Interval != old.Reconcile.Interval {
+		manager.ReconcileEvery(time.Duration(new.Reconcile.Interval))
+	}
+	// the ignorer options can only change with a restart, it picks up changed dropbox folders as well
+	if new.TryRun != old.TryRun || new.Matching != old.Matching || new.Workers != old.Workers || !reflect.DeepEqual(new.Watcher, old.Watcher) {
+		err = manager.Restart()
+	} else if new.Account != old.Account || !slices.Equal(new.Roots, old.Roots) {
+		err = manager.Sync()
+	}
+	if err != nil {
+		logger.Error("applying config failed", LogKeyError, err)
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// PlanVersion is the version of the plan file format
+const PlanVersion = 1
+
+var ErrPlanOutdated = errors.New("plan is outdated")
+
+type PlanAction string
+
+const (
+	PlanActionIgnore   PlanAction = "ignore"
+	PlanActionUnignore PlanAction = "unignore"
+)
+
+// Plan are the flag changes, that make the ignore flags match the ignore rules
+type Plan struct {
+	Version int        `json:"version"`
+	Created time.Time  `json:"created"`
+	Roots   []RootPlan `json:"roots"`
+}
+
+type RootPlan struct {
+	Root string `json:"root"`
+	// IgnoreFiles are the ignore files the plan was made with
+	IgnoreFiles []PlanIgnoreFile `json:"ignoreFiles"`
+	Changes     []PlanChange     `json:"changes"`
+}
+
+type PlanIgnoreFile struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+}
+
+type PlanChange struct {
+	Path   string     `json:"path"`
+	Action PlanAction `json:"action"`
+	IsDir  bool       `json:"isDir"`
+	// Size is the size of the file or of all files inside the directory in bytes
+	Size int64 `json:"size"`
+	// IgnoreFile and Rule ignore Path, they are empty for PlanActionUnignore
+	IgnoreFile string `json:"ignoreFile,omitempty"`
+	Rule       string `json:"rule,omitempty"`
+	// Line and Pattern are the line of IgnoreFile, that Rule is made of, for the review of shared ignore files
+	Line    int    `json:"line,omitempty"`
+	Pattern string `json:"pattern,omitempty"`
+}
+
+// Summary returns the number of paths and bytes of action
+func (p RootPlan) Summary(action PlanAction) (int, int64) {
+	count := 0
+	var size int64
+	for _, c := range p.Changes {
+		if c.Action == action {
+			count++
+			size += c.Size
+		}
+	}
+	return count, size
+}
+
+// diff describes the first difference to other, empty if both are equal
+func (p RootPlan) diff(other RootPlan) string {
+	if !slices.Equal(p.IgnoreFiles, other.IgnoreFiles) {
+		return "the ignore files changed"
+	}
+	for n := 0; n < len(p.Changes) || n < len(other.Changes); n++ {
+		switch {
+		case n >= len(other.Changes):
+			return fmt.Sprintf("%s %s is no longer needed", p.Changes[n].Action, p.Changes[n].Path)
+		case n >= len(p.Changes):
+			return fmt.Sprintf("%s %s is missing", other.Changes[n].Action, other.Changes[n].Path)
+		case p.Changes[n] != other.Changes[n]:
+			return fmt.Sprintf("%s %s changed", p.Changes[n].Action, p.Changes[n].Path)
+		}
+	}
+	return ""
+}
+
+// MakePlan walks the roots once without changing any flag and returns the needed flag changes
+func MakePlan(ctx context.Context, roots []string, logger *slog.Logger) (Plan, error) {
+	plan := Plan{
+		Version: PlanVersion,
+		Created: time.Now(),
+		Roots:   []RootPlan{},
+	}
+	for _, root := range roots {
+		i, err := ScanDropbox(root, true, logger, ctx, NewEventBus())
+		if err != nil {
+			return Plan{}, err
+		}
+		rootPlan, err := i.plan()
+		if err != nil {
+			return Plan{}, err
+		}
+		plan.Roots = append(plan.Roots, rootPlan)
+	}
+	return plan, nil
+}
+
+// ApplyPlan sets and removes the ignore flags of plan.
+// No flag is changed, if a new plan of the roots differs from plan.
+func ApplyPlan(ctx context.Context, plan Plan, logger *slog.Logger) error {
+	if plan.Version != PlanVersion {
+		return fmt.Errorf("unsupported plan version %d, expected %d", plan.Version, PlanVersion)
+	}
+	roots := make([]string, len(plan.Roots))
+	for n, rootPlan := range plan.Roots {
+		roots[n] = rootPlan.Root
+	}
+	current, err := MakePlan(ctx, roots, logger)
+	if err != nil {
+		return err
+	}
+	for n, rootPlan := range plan.Roots {
+		diff := rootPlan.diff(current.Roots[n])
+		if diff != "" {
+			return fmt.Errorf("%w, %s changed since %s: %s", ErrPlanOutdated, rootPlan.Root, plan.Created.Format(time.DateTime), diff)
+		}
+	}
+
+	logger = componentLogger(logger, LogComponentPlan)
+	for _, rootPlan := range plan.Roots {
+		for _, c := range rootPlan.Changes {
+			if c.Action == PlanActionIgnore {
+				logger.Info("ignoring path", LogKeyRoot, rootPlan.Root, LogKeyPath, c.Path, LogKeyRule, c.Rule, "source", fmt.Sprintf("%s:%d: %s", c.IgnoreFile, c.Line, c.Pattern))
+				err = SetDropboxIgnoreFlag(c.Path)
+			} else {
+				logger.Info("unignoring path", LogKeyRoot, rootPlan.Root, LogKeyPath, c.Path)
+				err = RemoveDropboxIgnoreFlag(c.Path)
+			}
+			if err != nil {
+				return fmt.Errorf("error applying %s of %s: %w", c.Action, c.Path, err)
+			}
+		}
+	}
+	return nil
+}
+
+// plan computes the changes, that make the ignore flags of the dropbox folder match the ignore rules.
+// The event loop must not run, ScanDropbox returns a suitable ignorer.
+func (i *DropboxIgnorer) plan() (RootPlan, error) {
+	rootPlan := RootPlan{
+		Root:        i.dropboxPath,
+		IgnoreFiles: []PlanIgnoreFile{},
+		Changes:     []PlanChange{},
+	}
+	ignoreFileData := map[string][]byte{}
+	for _, ignoreFile := range i.ignoreFiles.Values() {
+		data, err := os.ReadFile(ignoreFile)
+		if err != nil {
+			return RootPlan{}, fmt.Errorf("error reading ignore file %s: %w", ignoreFile, err)
+		}
+		ignoreFileData[ignoreFile] = data
+		sum := sha256.Sum256(data)
+		rootPlan.IgnoreFiles = append(rootPlan.IgnoreFiles, PlanIgnoreFile{Path: ignoreFile, SHA256: hex.EncodeToString(sum[:])})
+	}
+
+	// the content of an ignored directory keeps its flags, dropbox ignores it anyway
+	ignoredDirs := map[string]bool{}
+	err := ScanFlaggedPaths(i.ctx, []string{i.dropboxPath}, FlaggedScanOptions{
+		Workers:  i.workers,
+		AllPaths: true,
+		OnPath: func(p ScannedPath) {
+			shouldGetIgnored := i.ShouldPathGetIgnored(p.Path)
+			if shouldGetIgnored && p.IsDir {
+				ignoredDirs[p.Path] = true
+			}
+			switch {
+			case shouldGetIgnored && !p.Flagged:
+				ignoreFile, rule, _ := i.matchingIgnoreRule(p.Path)
+				rootPlan.Changes = append(rootPlan.Changes, PlanChange{Path: p.Path, Action: PlanActionIgnore, IsDir: p.IsDir, IgnoreFile: ignoreFile, Rule: rule})
+			case !shouldGetIgnored && p.Flagged:
+				rootPlan.Changes = append(rootPlan.Changes, PlanChange{Path: p.Path, Action: PlanActionUnignore, IsDir: p.IsDir})
+			}
+		},
+		SkipContent: func(p ScannedPath) bool {
+			return ignoredDirs[p.Path]
+		},
+	})
+	if err != nil {
+		return RootPlan{}, fmt.Errorf("error walking dir %s: %w", i.dropboxPath, err)
+	}
+
+	// only files/directories may have the ignore flag, but not symlinks
+	changes := rootPlan.Changes[:0]
+	for _, c := range rootPlan.Changes {
+		info, err := os.Lstat(c.Path)
+		if err != nil {
+			return RootPlan{}, fmt.Errorf("error stat %s: %w", c.Path, err)
+		}
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			continue
+		}
+		c.Size, err = pathSize(c.Path, info)
+		if err != nil {
+			return RootPlan{}, err
+		}
+		if c.Action == PlanActionIgnore {
+			c.Line, c.Pattern, _ = IgnoreRuleSource(c.IgnoreFile, ignoreFileData[c.IgnoreFile], c.Rule)
+		}
+		changes = append(changes, c)
+	}
+	// the directories are scanned in parallel
+	slices.SortFunc(changes, func(a, b PlanChange) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+	rootPlan.Changes = changes
+	return rootPlan, nil
+}
+
+// pathSize returns the size of a file or the size of all files inside a directory, symlinks are not followed
+func pathSize(path string, info fs.FileInfo) (int64, error) {
+	if !info.IsDir() {
+		return info.Size(), nil
+	}
+	var size int64
+	err := filepath.WalkDir(path, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error getting size of %s: %w", path, err)
+	}
+	return size, nil
+}
+
+// formatSize formats a size in bytes for humans
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,66 @@
+package main_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	main "github.com/anton15x/dropbox_ignore_service"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlan(t *testing.T) {
+	CheckTestParallel(t)
+
+	ctx := context.Background()
+	logger := NewTestLogger(t)
+	root := t.TempDir()
+	ignoreFile := filepath.Join(root, main.DropboxIgnoreFilename)
+	ignoredDir := filepath.Join(root, "node_modules")
+	unexpectedFile := filepath.Join(root, "notes.txt")
+	requireMkdir(t, ignoredDir)
+	requireNoError(t, os.WriteFile(filepath.Join(ignoredDir, "a"), []byte("12345"), os.ModePerm))
+	requireNoError(t, os.WriteFile(unexpectedFile, nil, os.ModePerm))
+	requireNoError(t, main.SetDropboxIgnoreFlag(unexpectedFile))
+	createDropboxignore(t, ignoreFile, "# shared rules", "node_modules")
+	// the content of ignored directories is not walked
+	nestedFile := filepath.Join(ignoredDir, "nested.txt")
+	requireNoError(t, os.WriteFile(nestedFile, nil, os.ModePerm))
+	requireNoError(t, main.SetDropboxIgnoreFlag(nestedFile))
+
+	plan, err := main.MakePlan(ctx, []string{root}, logger)
+	requireNoError(t, err)
+	require.Len(t, plan.Roots, 1)
+	require.Len(t, plan.Roots[0].IgnoreFiles, 1)
+	require.Equal(t, []main.PlanChange{
+		{Path: ignoredDir, Action: main.PlanActionIgnore, IsDir: true, Size: 5, IgnoreFile: ignoreFile, Rule: filepath.Join(root, "**", "node_modules"), Line: 2, Pattern: "node_modules"},
+		{Path: unexpectedFile, Action: main.PlanActionUnignore},
+	}, plan.Roots[0].Changes)
+
+	// a changed tree leaves every flag untouched
+	requireNoError(t, os.WriteFile(filepath.Join(ignoredDir, "b"), nil, os.ModePerm))
+	requireNoError(t, os.WriteFile(filepath.Join(ignoredDir, "a"), []byte("123456"), os.ModePerm))
+	err = main.ApplyPlan(ctx, plan, logger)
+	require.ErrorIs(t, err, main.ErrPlanOutdated)
+	hasFlag, err := main.HasDropboxIgnoreFlag(unexpectedFile)
+	requireNoError(t, err)
+	require.True(t, hasFlag)
+
+	plan, err = main.MakePlan(ctx, []string{root}, logger)
+	requireNoError(t, err)
+	requireNoError(t, main.ApplyPlan(ctx, plan, logger))
+	hasFlag, err = main.HasDropboxIgnoreFlag(unexpectedFile)
+	requireNoError(t, err)
+	require.False(t, hasFlag)
+	hasFlag, err = main.HasDropboxIgnoreFlag(ignoredDir)
+	requireNoError(t, err)
+	require.True(t, hasFlag)
+
+	plan, err = main.MakePlan(ctx, []string{root}, logger)
+	requireNoError(t, err)
+	require.Empty(t, plan.Roots[0].Changes)
+
+	createDropboxignore(t, ignoreFile, "node_modules", "*.txt")
+	require.ErrorIs(t, main.ApplyPlan(ctx, plan, logger), main.ErrPlanOutdated)
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// DefaultReconcileInterval is the default interval between two reconcile walks of a dropbox folder
+const DefaultReconcileInterval = 24 * time.Hour
+
+// DriftReport compares the ignore flags on disk with the ignore rules
+type DriftReport struct {
+	Root     string
+	Started  time.Time
+	Finished time.Time
+	Walked   int
+
+	// MissingFlags are paths the ignore rules ignore, but that have no ignore flag
+	MissingFlags []string
+	// UnexpectedFlags are flagged paths, that no ignore rule ignores
+	UnexpectedFlags []string
+	// NestedFlags are flagged paths inside a flagged directory, the content of ignored directories is not walked
+	NestedFlags []string
+	// Fixed are the missing flags, that got set
+	Fixed []string
+
+	Err error
+}
+
+func (r DriftReport) HasDrift() bool {
+	return len(r.MissingFlags) > 0 || len(r.UnexpectedFlags) > 0 || len(r.NestedFlags) > 0
+}
+
+func (r DriftReport) String() string {
+	s := fmt.Sprintf("%d missing flags, %d unexpected flags, %d flags inside flagged directories", len(r.MissingFlags), len(r.UnexpectedFlags), len(r.NestedFlags))
+	if len(r.Fixed) > 0 {
+		s += fmt.Sprintf(", %d missing flags set", len(r.Fixed))
+	}
+	if r.Err != nil {
+		s += ": " + r.Err.Error()
+	}
+	return s
+}
+
+type reconcileRequest struct {
+	fix    bool
+	report chan DriftReport
+}
+
+// reconcileResult is sent back to the event loop by the reconcile walk
+type reconcileResult struct {
+	request reconcileRequest
+	fix     bool
+	report  DriftReport
+}
+
+// Reconcile walks the dropbox folder and reports the drift between the ignore flags and the ignore rules.
+// If fix is set, the missing flags are set, unless the ignorer is paused or a try run.
+// The walk runs next to the event loop, the event loop sets the missing flags. It waits until the event loop is running.
+func (i *DropboxIgnorer) Reconcile(fix bool) (DriftReport, error) {
+	r := reconcileRequest{
+		fix:    fix,
+		report: make(chan DriftReport, 1),
+	}
+	select {
+	case <-i.ctx.Done():
+		return DriftReport{}, i.ctx.Err()
+	case i.reconcileRequests <- r:
+	}
+	select {
+	case <-i.ctx.Done():
+		return DriftReport{}, i.ctx.Err()
+	case report := <-r.report:
+		return report, nil
+	}
+}
+
+// LastDriftReport returns the report of the last reconcile walk, or nil
+func (i *DropboxIgnorer) LastDriftReport() *DriftReport {
+	return i.lastDriftReport.Load()
+}
+
+func (i *DropboxIgnorer) AddDriftReportEventListener(f func(DriftReport)) {
+	i.listenersMutex.Lock()
+	defer i.listenersMutex.Unlock()
+
+	i.onDriftReport = append(i.onDriftReport, f)
+}
+
+func (i *DropboxIgnorer) handleReconcileRequest(r reconcileRequest) {
+	fix := r.fix
+	if fix && (i.tryRun || i.paused.Load()) {
+		i.logger.Info("reconcile only reports the missing flags, it is paused or a try run")
+		fix = false
+	}
+
+	// the ignore patterns of the event loop change while walking
+	rules := i.ignoreRulesSnapshot()
+	i.wg.Add(1)
+	go func() {
+		defer i.wg.Done()
+
+		report := i.reconcile(rules)
+		select {
+		case <-i.ctx.Done():
+		case i.reconcileResults <- reconcileResult{request: r, fix: fix, report: report}:
+		}
+	}()
+}
+
+// handleReconcileResult sets the missing flags found by the reconcile walk and reports the drift
+func (i *DropboxIgnorer) handleReconcileResult(result reconcileResult) {
+	report := result.report
+	if result.fix && !i.paused.Load() {
+		for _, path := range report.MissingFlags {
+			if !i.ShouldPathGetIgnored(path) {
+				// the ignore rules changed since the walk
+				continue
+			}
+			err := i.SetIgnoreFlag(path, CauseReconcile)
+			if err != nil {
+				i.logger.Error("ignoring path failed", LogKeyPath, path, LogKeyError, err)
+			} else {
+				report.Fixed = append(report.Fixed, path)
+			}
+		}
+	}
+
+	i.lastDriftReport.Store(&report)
+	i.logger.Info("reconcile finished", "duration", report.Finished.Sub(report.Started).Round(time.Millisecond), "report", report.String())
+
+	i.listenersMutex.Lock()
+	listeners := slices.Clone(i.onDriftReport)
+	i.listenersMutex.Unlock()
+	for _, f := range listeners {
+		f(report)
+	}
+
+	result.request.report <- report
+}
+
+// reconcile walks the dropbox folder and matches the paths with rules, a snapshot of the ignore rules
+func (i *DropboxIgnorer) reconcile(rules *DropboxIgnorer) DriftReport {
+	report := DriftReport{
+		Root:    i.dropboxPath,
+		Started: time.Now(),
+	}
+	// outerDirs are the flagged directories, their content is only checked for nested flags
+	outerDirs := map[string]bool{}
+	isInsideOuterDir := func(path string) bool {
+		for dir := path; dir != i.dropboxPath; {
+			parent := filepath.Dir(dir)
+			if parent == dir {
+				return false
+			}
+			dir = parent
+			if outerDirs[dir] {
+				return true
+			}
+		}
+		return false
+	}
+	// ignoredDirs are not walked, like at the initial walk
+	ignoredDirs := map[string]bool{}
+
+	err := ScanFlaggedPaths(i.ctx, []string{i.dropboxPath}, FlaggedScanOptions{
+		Workers:  i.workers,
+		AllPaths: true,
+		OnPath: func(p ScannedPath) {
+			report.Walked++
+			if isInsideOuterDir(p.Path) {
+				if p.Flagged {
+					report.NestedFlags = append(report.NestedFlags, p.Path)
+				}
+				return
+			}
+
+			shouldGetIgnored := rules.ShouldPathGetIgnored(p.Path)
+			if shouldGetIgnored && !p.Flagged {
+				report.MissingFlags = append(report.MissingFlags, p.Path)
+			}
+			if !shouldGetIgnored && p.Flagged {
+				report.UnexpectedFlags = append(report.UnexpectedFlags, p.Path)
+			}
+			if shouldGetIgnored && p.IsDir {
+				ignoredDirs[p.Path] = true
+			} else if p.Flagged && p.IsDir {
+				outerDirs[p.Path] = true
+			}
+		},
+		SkipContent: func(p ScannedPath) bool {
+			return ignoredDirs[p.Path]
+		},
+	})
+	if err != nil {
+		report.Err = fmt.Errorf("error walking dir %s: %w", i.dropboxPath, err)
+	}
+	// the directories are scanned in parallel
+	for _, paths := range [][]string{report.MissingFlags, report.UnexpectedFlags, report.NestedFlags} {
+		slices.Sort(paths)
+	}
+	report.Finished = time.Now()
+
+	return report
+}
@@ -0,0 +1,89 @@
+package main_test
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	main "github.com/anton15x/dropbox_ignore_service"
+	"github.com/anton15x/dropbox_ignore_service/src/fsnotify"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDropboxIgnorerReconcile(t *testing.T) {
+	CheckTestParallel(t)
+
+	tmpTestDir := t.TempDir()
+	dropboxDir := filepath.Join(tmpTestDir, "dropbox")
+	requireMkdir(t, dropboxDir)
+	defer PrintFileTreeIfTestFailed(t, dropboxDir)
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer ctxCancel()
+
+	createDropboxignore(t, filepath.Join(dropboxDir, main.DropboxIgnoreFilename), "node_modules")
+	nodeModulesDir := filepath.Join(dropboxDir, "a", "node_modules")
+	// the content of ignored directories is not walked
+	ignoredNestedDir := filepath.Join(nodeModulesDir, "x")
+	unexpectedDir := filepath.Join(dropboxDir, "b")
+	nestedDir := filepath.Join(unexpectedDir, "x")
+	requireMkdir(t, filepath.Dir(nodeModulesDir))
+	requireMkdir(t, nodeModulesDir)
+	requireMkdir(t, ignoredNestedDir)
+	requireMkdir(t, unexpectedDir)
+	requireMkdir(t, nestedDir)
+
+	// the watcher must not see the flag changes, the reconcile walk has to find them
+	options := fsnotify.Options{
+		Backend:      fsnotify.BackendPolling,
+		PollInterval: time.Hour,
+	}
+	var wg sync.WaitGroup
+	i, err := main.NewDropboxIgnorer(dropboxDir, false, NewTestLogger(t), ctx, &wg, main.NewEventBus(), options)
+	requireNoError(t, err)
+	defer PrintDropboxIgnorerStatsIfTestFailed(t, i)
+	require.True(t, i.IgnoredPathsSet().Has(nodeModulesDir))
+	reports := make(chan main.DriftReport, 10)
+	i.AddDriftReportEventListener(func(r main.DriftReport) {
+		reports <- r
+	})
+	i.ListenForEvents()
+
+	report, err := i.Reconcile(true)
+	requireNoError(t, err)
+	require.False(t, report.HasDrift(), report.String())
+
+	requireNoError(t, main.RemoveDropboxIgnoreFlag(nodeModulesDir))
+	requireNoError(t, main.SetDropboxIgnoreFlag(ignoredNestedDir))
+	requireNoError(t, main.SetDropboxIgnoreFlag(unexpectedDir))
+	requireNoError(t, main.SetDropboxIgnoreFlag(nestedDir))
+
+	check := func(report main.DriftReport) {
+		require.Equal(t, dropboxDir, report.Root)
+		require.Equal(t, []string{nodeModulesDir}, report.MissingFlags)
+		require.Equal(t, []string{unexpectedDir}, report.UnexpectedFlags)
+		require.Equal(t, []string{nestedDir}, report.NestedFlags)
+		require.Nil(t, report.Err)
+	}
+	report, err = i.Reconcile(false)
+	requireNoError(t, err)
+	check(report)
+	require.Empty(t, report.Fixed)
+	hasFlag, err := main.HasDropboxIgnoreFlag(nodeModulesDir)
+	requireNoError(t, err)
+	require.False(t, hasFlag)
+
+	report, err = i.Reconcile(true)
+	requireNoError(t, err)
+	check(report)
+	require.Equal(t, []string{nodeModulesDir}, report.Fixed)
+	hasFlag, err = main.HasDropboxIgnoreFlag(nodeModulesDir)
+	requireNoError(t, err)
+	require.True(t, hasFlag)
+	require.Equal(t, report.Fixed, i.LastDriftReport().Fixed)
+	require.Len(t, reports, 3)
+
+	ctxCancel()
+	wg.Wait()
+}
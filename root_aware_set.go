@@ -0,0 +1,138 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// RootAwareSet combines the sets of several dropbox folders and keeps track of the dropbox folder of every entry.
+// The combined values are only changed by the sets of the dropbox folders.
+type RootAwareSet struct {
+	// all contains the values of all dropbox folders
+	all *SortedStringSet
+
+	m     sync.RWMutex
+	roots map[string]*SortedStringSet
+}
+
+func NewRootAwareSet() *RootAwareSet {
+	return &RootAwareSet{
+		all:   NewSortedStringSet(),
+		roots: map[string]*SortedStringSet{},
+	}
+}
+
+// AddRoot adds the values of set and follows its changes
+func (s *RootAwareSet) AddRoot(root string, set *SortedStringSet) {
+	s.m.Lock()
+	s.roots[root] = set
+	s.m.Unlock()
+
+	// the listeners can not get removed from set => they ignore changes after RemoveRoot
+	isCurrent := func() bool {
+		s.m.RLock()
+		defer s.m.RUnlock()
+
+		return s.roots[root] == set
+	}
+	set.AddAddEventListener(func(val string) {
+		if isCurrent() {
+			s.all.Add(val)
+		}
+	})
+	set.AddRemoveEventListener(func(val string) {
+		if isCurrent() {
+			s.all.Remove(val)
+		}
+	})
+	for _, val := range set.Values() {
+		s.all.Add(val)
+	}
+}
+
+// RemoveRoot removes the values of root
+func (s *RootAwareSet) RemoveRoot(root string) {
+	s.m.Lock()
+	set, ok := s.roots[root]
+	delete(s.roots, root)
+	s.m.Unlock()
+	if !ok {
+		return
+	}
+
+	for _, val := range set.Values() {
+		s.all.Remove(val)
+	}
+}
+
+// Roots returns the sorted dropbox folders
+func (s *RootAwareSet) Roots() []string {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	roots := make([]string, 0, len(s.roots))
+	for root := range s.roots {
+		roots = append(roots, root)
+	}
+	slices.Sort(roots)
+	return roots
+}
+
+// Root returns the dropbox folder, that contains path
+func (s *RootAwareSet) Root(path string) (string, bool) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	found := ""
+	for root := range s.roots {
+		if path != root && !strings.HasPrefix(path, root+string(filepath.Separator)) {
+			continue
+		}
+		// nested dropbox folders => the innermost one
+		if len(root) > len(found) {
+			found = root
+		}
+	}
+	return found, found != ""
+}
+
+// RootSet returns the set of root, or nil if root is unknown
+func (s *RootAwareSet) RootSet(root string) *SortedStringSet {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	return s.roots[root]
+}
+
+// RootLen returns the number of values of root
+func (s *RootAwareSet) RootLen(root string) int {
+	set := s.RootSet(root)
+	if set == nil {
+		return 0
+	}
+	return set.Len()
+}
+
+func (s *RootAwareSet) Len() int {
+	return s.all.Len()
+}
+func (s *RootAwareSet) GetOrEmptyString(i int) string {
+	return s.all.GetOrEmptyString(i)
+}
+func (s *RootAwareSet) Values() []string {
+	return s.all.Values()
+}
+func (s *RootAwareSet) Has(val string) bool {
+	return s.all.Has(val)
+}
+func (s *RootAwareSet) AddAddEventListener(f func(string)) {
+	s.all.AddAddEventListener(f)
+}
+func (s *RootAwareSet) AddRemoveEventListener(f func(string)) {
+	s.all.AddRemoveEventListener(f)
+}
+func (s *RootAwareSet) AddChangeEventListener(f func()) {
+	s.all.AddChangeEventListener(f)
+}
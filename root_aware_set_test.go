@@ -0,0 +1,52 @@
+package main_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	main "github.com/anton15x/dropbox_ignore_service"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRootAwareSet(t *testing.T) {
+	personalRoot := filepath.Join(t.TempDir(), "Dropbox (Personal)")
+	businessRoot := filepath.Join(t.TempDir(), "Dropbox (Business)")
+	personal := main.NewSortedStringSet()
+	business := main.NewSortedStringSet()
+	personal.Add(filepath.Join(personalRoot, "a"))
+
+	set := main.NewRootAwareSet()
+	changes := 0
+	set.AddChangeEventListener(func() {
+		changes++
+	})
+	set.AddRoot(personalRoot, personal)
+	set.AddRoot(businessRoot, business)
+	require.Equal(t, []string{filepath.Join(personalRoot, "a")}, set.Values())
+
+	business.Add(filepath.Join(businessRoot, "a"))
+	business.Add(filepath.Join(businessRoot, "b"))
+	require.Equal(t, 3, set.Len())
+	require.Equal(t, 1, set.RootLen(personalRoot))
+	require.Equal(t, 2, set.RootLen(businessRoot))
+	require.ElementsMatch(t, []string{personalRoot, businessRoot}, set.Roots())
+
+	root, ok := set.Root(filepath.Join(businessRoot, "b", "c"))
+	require.True(t, ok)
+	require.Equal(t, businessRoot, root)
+	_, ok = set.Root(filepath.Dir(businessRoot))
+	require.False(t, ok)
+
+	// the view follows the removals of the set of a dropbox folder
+	require.True(t, business.Remove(filepath.Join(businessRoot, "a")))
+	require.Equal(t, []string{filepath.Join(businessRoot, "b")}, business.Values())
+	require.Equal(t, []string{filepath.Join(personalRoot, "a")}, personal.Values())
+	require.False(t, set.Has(filepath.Join(businessRoot, "a")))
+
+	set.RemoveRoot(businessRoot)
+	require.Equal(t, []string{filepath.Join(personalRoot, "a")}, set.Values())
+	business.Add(filepath.Join(businessRoot, "c"))
+	require.Equal(t, 1, set.Len())
+	require.Equal(t, 0, set.RootLen(businessRoot))
+	require.Equal(t, 5, changes)
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RootsCheckInterval is the interval the dropbox config file is checked for added or removed dropbox folders
+const RootsCheckInterval = 5 * time.Second
+
+// RootManager runs a DropboxIgnorer for every dropbox folder.
+// Sync starts the ignorers of new dropbox folders and stops the ones of removed dropbox folders.
+type RootManager struct {
+	ctx    context.Context
+	wg     *sync.WaitGroup
+	logger *slog.Logger
+	// ignorerLogger has no component, the ignorers add their own
+	ignorerLogger *slog.Logger
+	events        *EventBus
+
+	// findRoots returns the current dropbox folders
+	findRoots      func() ([]string, error)
+	ignorerOptions func(root string) IgnorerOptions
+
+	ignoredPathsSet    *RootAwareSet
+	ignoreFilesSet     *RootAwareSet
+	alreadyUploadedSet *RootAwareSet
+
+	// syncMutex serializes Sync and Restart, the ignorers are started and stopped without holding m
+	syncMutex sync.Mutex
+	// m guards roots and startPaused
+	m           sync.Mutex
+	roots       map[string]*managedRoot
+	startPaused map[string]bool
+
+	// reconcileFix sets the missing flags found by Reconcile
+	reconcileFix atomic.Bool
+	// reconcileStop stops the ticker of ReconcileEvery
+	reconcileMutex sync.Mutex
+	reconcileStop  context.CancelFunc
+
+	listenersMutex sync.Mutex
+	onRootsChange  []func()
+}
+
+type managedRoot struct {
+	ignorer *DropboxIgnorer
+	stop    context.CancelFunc
+	wg      *sync.WaitGroup
+}
+
+func NewRootManager(ctx context.Context, wg *sync.WaitGroup, logger *slog.Logger, events *EventBus, findRoots func() ([]string, error), ignorerOptions func(root string) IgnorerOptions) *RootManager {
+	return &RootManager{
+		ctx:            ctx,
+		wg:             wg,
+		logger:         componentLogger(logger, LogComponentManager),
+		ignorerLogger:  logger,
+		events:         events,
+		findRoots:      findRoots,
+		ignorerOptions: ignorerOptions,
+
+		ignoredPathsSet:    NewRootAwareSet(),
+		ignoreFilesSet:     NewRootAwareSet(),
+		alreadyUploadedSet: NewRootAwareSet(),
+
+		roots:       map[string]*managedRoot{},
+		startPaused: map[string]bool{},
+	}
+}
+
+// SetStartPaused starts the ignorers of roots paused, they do not change any flag until they get resumed
+func (m *RootManager) SetStartPaused(roots ...string) {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	for _, root := range roots {
+		m.startPaused[root] = true
+	}
+}
+
+func (m *RootManager) IgnoredPathsSet() *RootAwareSet {
+	return m.ignoredPathsSet
+}
+func (m *RootManager) IgnoreFilesSet() *RootAwareSet {
+	return m.ignoreFilesSet
+}
+func (m *RootManager) AlreadyUploadedSet() *RootAwareSet {
+	return m.alreadyUploadedSet
+}
+func (m *RootManager) Events() *EventBus {
+	return m.events
+}
+
+// Ignorers returns the running dropbox ignorers sorted by their dropbox folder
+func (m *RootManager) Ignorers() []*DropboxIgnorer {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	ignorers := make([]*DropboxIgnorer, 0, len(m.roots))
+	for _, r := range m.roots {
+		ignorers = append(ignorers, r.ignorer)
+	}
+	slices.SortFunc(ignorers, func(a, b *DropboxIgnorer) int {
+		if a.DropboxPath() < b.DropboxPath() {
+			return -1
+		}
+		if a.DropboxPath() > b.DropboxPath() {
+			return 1
+		}
+		return 0
+	})
+	return ignorers
+}
+
+// AddRootsChangeEventListener is called after dropbox folders got added or removed
+func (m *RootManager) AddRootsChangeEventListener(f func()) {
+	m.listenersMutex.Lock()
+	defer m.listenersMutex.Unlock()
+
+	m.onRootsChange = append(m.onRootsChange, f)
+}
+
+// Sync starts and stops the dropbox ignorers to match the current dropbox folders.
+// A dropbox folder, that could not be started, is retried at the next Sync.
+func (m *RootManager) Sync() error {
+	return m.sync(false)
+}
+
+func (m *RootManager) sync(restart bool) error {
+	m.syncMutex.Lock()
+	defer m.syncMutex.Unlock()
+
+	roots, err := m.findRoots()
+	if err != nil {
+		return fmt.Errorf("error finding dropbox folders: %w", err)
+	}
+	wanted := map[string]bool{}
+	for _, root := range roots {
+		absPath, err := filepath.Abs(root)
+		if err != nil {
+			return fmt.Errorf("error getting abs path of %s: %w", root, err)
+		}
+		wanted[absPath] = true
+	}
+
+	stopped := map[string]*managedRoot{}
+	var started []string
+	func() {
+		m.m.Lock()
+		defer m.m.Unlock()
+
+		for root, r := range m.roots {
+			if !restart && wanted[root] {
+				continue
+			}
+			if wanted[root] {
+				if r.ignorer.Paused() {
+					m.startPaused[root] = true
+				} else {
+					delete(m.startPaused, root)
+				}
+				m.logger.Info("restarting dropbox ignorer", LogKeyRoot, root)
+			} else {
+				m.logger.Info("dropbox folder got removed, stopping its dropbox ignorer", LogKeyRoot, root)
+			}
+			stopped[root] = r
+			delete(m.roots, root)
+		}
+		for root := range wanted {
+			if _, ok := m.roots[root]; !ok {
+				started = append(started, root)
+			}
+		}
+	}()
+	slices.Sort(started)
+
+	for root, r := range stopped {
+		m.stopRoot(root, r)
+	}
+	changed := len(stopped) > 0
+	var errs []error
+	for _, root := range started {
+		err := m.startRoot(root)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		changed = true
+	}
+
+	if changed {
+		m.listenersMutex.Lock()
+		listeners := slices.Clone(m.onRootsChange)
+		m.listenersMutex.Unlock()
+		for _, f := range listeners {
+			f()
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Restart restarts every dropbox ignorer with the current ignorer options, paused ignorers start paused again
+func (m *RootManager) Restart() error {
+	return m.sync(true)
+}
+
+// startRoot runs the initial walk without holding m, so Ignorers does not block until it is finished
+func (m *RootManager) startRoot(root string) error {
+	m.m.Lock()
+	paused := m.startPaused[root]
+	m.m.Unlock()
+
+	ctx, stop := context.WithCancel(m.ctx)
+	var wg sync.WaitGroup
+	ignorer, err := NewDropboxIgnorerWithOptions(root, m.ignorerLogger, ctx, &wg, m.events, m.ignorerOptions(root), paused)
+	if err != nil {
+		stop()
+		return fmt.Errorf("error creating dropbox ignorer for %s: %w", root, err)
+	}
+	m.m.Lock()
+	m.roots[root] = &managedRoot{
+		ignorer: ignorer,
+		stop:    stop,
+		wg:      &wg,
+	}
+	m.m.Unlock()
+	m.ignoredPathsSet.AddRoot(root, ignorer.IgnoredPathsSet())
+	m.ignoreFilesSet.AddRoot(root, ignorer.IgnoreFiles())
+	m.alreadyUploadedSet.AddRoot(root, ignorer.AlreadyUploadedSet())
+
+	// the ignorers of the manager are waited for by the wait group of the manager
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		<-ctx.Done()
+		wg.Wait()
+	}()
+
+	m.logger.Info("listening for events", LogKeyRoot, root)
+	ignorer.ListenForEvents()
+	return nil
+}
+
+// stopRoot stops the ignorer of a root, that was removed from roots
+func (m *RootManager) stopRoot(root string, r *managedRoot) {
+	r.stop()
+	r.wg.Wait()
+	m.ignoredPathsSet.RemoveRoot(root)
+	m.ignoreFilesSet.RemoveRoot(root)
+	m.alreadyUploadedSet.RemoveRoot(root)
+}
+
+// Watch calls Sync every interval until the context of the manager is done
+func (m *RootManager) Watch(interval time.Duration) {
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-m.ctx.Done():
+				return
+			case <-ticker.C:
+				err := m.Sync()
+				if err != nil {
+					m.logger.Error("updating dropbox folders failed", LogKeyError, err)
+				}
+			}
+		}
+	}()
+}
+
+func (m *RootManager) SetReconcileFix(fix bool) {
+	m.reconcileFix.Store(fix)
+}
+func (m *RootManager) ReconcileFix() bool {
+	return m.reconcileFix.Load()
+}
+
+// Reconcile reconciles the dropbox folders one after another
+func (m *RootManager) Reconcile() []DriftReport {
+	var reports []DriftReport
+	for _, ignorer := range m.Ignorers() {
+		report, err := ignorer.Reconcile(m.ReconcileFix())
+		if err != nil {
+			// shutting down
+			break
+		}
+		reports = append(reports, report)
+	}
+	return reports
+}
+
+// ReconcileEvery calls Reconcile every interval until the context of the manager is done.
+// It replaces the interval of the previous call, 0 stops reconciling.
+func (m *RootManager) ReconcileEvery(interval time.Duration) {
+	m.reconcileMutex.Lock()
+	defer m.reconcileMutex.Unlock()
+
+	if m.reconcileStop != nil {
+		m.reconcileStop()
+		m.reconcileStop = nil
+	}
+	if interval <= 0 {
+		return
+	}
+	ctx, stop := context.WithCancel(m.ctx)
+	m.reconcileStop = stop
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.Reconcile()
+			}
+		}
+	}()
+}
@@ -0,0 +1,181 @@
+package main_test
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	main "github.com/anton15x/dropbox_ignore_service"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRootManager(t *testing.T) {
+	CheckTestParallel(t)
+
+	tmpTestDir := t.TempDir()
+	dropboxA := filepath.Join(tmpTestDir, "a")
+	dropboxB := filepath.Join(tmpTestDir, "b")
+	for _, dir := range []string{dropboxA, dropboxB} {
+		createDropboxignore(t, filepath.Join(dir, main.DropboxIgnoreFilename), "node_modules")
+		requireMkdir(t, filepath.Join(dir, "node_modules"))
+	}
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer ctxCancel()
+
+	var rootsMutex sync.Mutex
+	roots := []string{dropboxA}
+	findRoots := func() ([]string, error) {
+		rootsMutex.Lock()
+		defer rootsMutex.Unlock()
+
+		return roots, nil
+	}
+	setRoots := func(r ...string) {
+		rootsMutex.Lock()
+		defer rootsMutex.Unlock()
+
+		roots = r
+	}
+	ignorerOptions := func(root string) main.IgnorerOptions {
+		return main.IgnorerOptions{}
+	}
+
+	var wg sync.WaitGroup
+	m := main.NewRootManager(ctx, &wg, NewTestLogger(t), main.NewEventBus(), findRoots, ignorerOptions)
+	rootsChanged := make(chan struct{}, 10)
+	m.AddRootsChangeEventListener(func() {
+		rootsChanged <- struct{}{}
+	})
+	added := make(chan string, 100)
+	m.IgnoredPathsSet().AddAddEventListener(func(s string) {
+		added <- s
+	})
+
+	requireNoError(t, m.Sync())
+	readChanTimeout(t, rootsChanged, time.Second, "roots change")
+	require.Len(t, m.Ignorers(), 1)
+	require.Equal(t, []string{dropboxA}, m.IgnoredPathsSet().Roots())
+	require.Equal(t, []string{filepath.Join(dropboxA, "node_modules")}, m.IgnoredPathsSet().Values())
+
+	// unchanged roots
+	requireNoError(t, m.Sync())
+	require.Len(t, rootsChanged, 0)
+
+	setRoots(dropboxA, dropboxB)
+	requireNoError(t, m.Sync())
+	readChanTimeout(t, rootsChanged, time.Second, "roots change")
+	require.Len(t, m.Ignorers(), 2)
+	require.Equal(t, []string{
+		filepath.Join(dropboxA, "node_modules"),
+		filepath.Join(dropboxB, "node_modules"),
+	}, m.IgnoredPathsSet().Values())
+
+	setRoots(dropboxB)
+	requireNoError(t, m.Sync())
+	readChanTimeout(t, rootsChanged, time.Second, "roots change")
+	ignorers := m.Ignorers()
+	require.Len(t, ignorers, 1)
+	require.Equal(t, dropboxB, ignorers[0].DropboxPath())
+	require.Equal(t, []string{filepath.Join(dropboxB, "node_modules")}, m.IgnoredPathsSet().Values())
+	require.Equal(t, []string{dropboxB}, m.IgnoreFilesSet().Roots())
+
+	// the ignorer of the removed root is stopped, the one of b is still running
+	for len(added) > 0 {
+		<-added
+	}
+	requireMkdir(t, filepath.Join(dropboxA, "x"))
+	requireMkdir(t, filepath.Join(dropboxA, "x", "node_modules"))
+	requireMkdir(t, filepath.Join(dropboxB, "x"))
+	requireMkdir(t, filepath.Join(dropboxB, "x", "node_modules"))
+	path := readChanTimeout(t, added, 20*time.Second, "ignored path of b")
+	require.Equal(t, filepath.Join(dropboxB, "x", "node_modules"), path)
+	require.False(t, m.IgnoredPathsSet().Has(filepath.Join(dropboxA, "x", "node_modules")))
+
+	// a root, that can not be started, is reported and retried at the next Sync
+	dropboxC := filepath.Join(tmpTestDir, "c")
+	setRoots(dropboxB, dropboxC)
+	require.Error(t, m.Sync())
+	require.Len(t, m.Ignorers(), 1)
+	requireMkdir(t, dropboxC)
+	requireNoError(t, m.Sync())
+	readChanTimeout(t, rootsChanged, time.Second, "roots change")
+	require.Len(t, m.Ignorers(), 2)
+
+	// a restart keeps the pause state
+	ignorers = m.Ignorers()
+	ignorers[0].Pause()
+	requireNoError(t, m.Restart())
+	readChanTimeout(t, rootsChanged, time.Second, "roots change")
+	restarted := m.Ignorers()
+	require.Len(t, restarted, 2)
+	require.NotSame(t, ignorers[0], restarted[0])
+	require.True(t, restarted[0].Paused())
+	require.False(t, restarted[1].Paused())
+
+	// without dropbox folders every ignorer is stopped
+	setRoots()
+	requireNoError(t, m.Sync())
+	readChanTimeout(t, rootsChanged, time.Second, "roots change")
+	require.Empty(t, m.Ignorers())
+	require.Empty(t, m.IgnoredPathsSet().Values())
+
+	ctxCancel()
+	wg.Wait()
+}
+
+// TestRootManagerSyncDoesNotBlock checks, that the ignorers can be read while a new root is started
+func TestRootManagerSyncDoesNotBlock(t *testing.T) {
+	CheckTestParallel(t)
+
+	tmpTestDir := t.TempDir()
+	dropboxA := filepath.Join(tmpTestDir, "a")
+	dropboxB := filepath.Join(tmpTestDir, "b")
+	requireMkdir(t, dropboxA)
+	requireMkdir(t, dropboxB)
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer ctxCancel()
+
+	var rootsMutex sync.Mutex
+	roots := []string{dropboxA}
+	findRoots := func() ([]string, error) {
+		rootsMutex.Lock()
+		defer rootsMutex.Unlock()
+
+		return roots, nil
+	}
+	startingB := make(chan struct{}, 1)
+	continueB := make(chan struct{})
+	ignorerOptions := func(root string) main.IgnorerOptions {
+		if root == dropboxB {
+			startingB <- struct{}{}
+			<-continueB
+		}
+		return main.IgnorerOptions{}
+	}
+
+	var wg sync.WaitGroup
+	m := main.NewRootManager(ctx, &wg, NewTestLogger(t), main.NewEventBus(), findRoots, ignorerOptions)
+	requireNoError(t, m.Sync())
+
+	rootsMutex.Lock()
+	roots = []string{dropboxA, dropboxB}
+	rootsMutex.Unlock()
+	synced := make(chan error, 1)
+	go func() {
+		synced <- m.Sync()
+	}()
+	readChanTimeout(t, startingB, 20*time.Second, "start of b")
+	ignorers := make(chan []*main.DropboxIgnorer, 1)
+	go func() {
+		ignorers <- m.Ignorers()
+	}()
+	require.Len(t, readChanTimeout(t, ignorers, 20*time.Second, "ignorers while b starts"), 1)
+	close(continueB)
+	requireNoError(t, readChanTimeout(t, synced, 20*time.Second, "sync"))
+	require.Len(t, m.Ignorers(), 2)
+
+	ctxCancel()
+	wg.Wait()
+}
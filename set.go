@@ -1,63 +1,87 @@
 package main
 
 import (
+	"fmt"
 	"slices"
+	"sync"
+
+	"github.com/anton15x/dropbox_ignore_service/src/treap"
 )
 
+// SortedStringSet is safe for concurrent use.
+// Listeners are called after the lock got released, so they may use the set themselves.
 type SortedStringSet struct {
-	values   []string
-	valueMap map[string]interface{}
+	m      sync.RWMutex
+	values treap.StringTreap
 
-	onAdd    []func(string)
-	onRemove []func(string)
+	listenersMutex sync.Mutex
+	onAdd          []func(string)
+	onRemove       []func(string)
 }
 
 func NewSortedStringSet() *SortedStringSet {
-	return &SortedStringSet{
-		values:   []string{},
-		valueMap: map[string]interface{}{},
-	}
+	return &SortedStringSet{}
 }
 
 func (us *SortedStringSet) Len() int {
-	return len(us.values)
+	us.m.RLock()
+	defer us.m.RUnlock()
+
+	return us.values.Len()
 }
 
+// GetOrEmptyString is used by the gui lists, the set could have shrunk since their Len call
 func (us *SortedStringSet) GetOrEmptyString(i int) string {
-	if i < us.Len() {
-		return us.Get(i)
-	}
+	us.m.RLock()
+	defer us.m.RUnlock()
 
-	return ""
+	val, _ := us.values.Get(i)
+	return val
 }
 
 func (us *SortedStringSet) Get(i int) string {
-	return us.values[i]
+	us.m.RLock()
+	defer us.m.RUnlock()
+
+	val, ok := us.values.Get(i)
+	if !ok {
+		panic(fmt.Sprintf("index %d out of range of SortedStringSet with length %d", i, us.values.Len()))
+	}
+	return val
 }
 
+// Values returns a sorted snapshot, that is not affected by later changes
 func (us *SortedStringSet) Values() []string {
-	ret := make([]string, len(us.values))
-	copy(ret, us.values)
-	return ret
+	us.m.RLock()
+	defer us.m.RUnlock()
+
+	return us.values.Values()
+}
+
+// ValuesWithPrefix returns a sorted snapshot of the values starting with prefix
+func (us *SortedStringSet) ValuesWithPrefix(prefix string) []string {
+	us.m.RLock()
+	defer us.m.RUnlock()
+
+	return us.values.ValuesWithPrefix(prefix)
 }
 
 func (us *SortedStringSet) Has(val string) bool {
-	_, ok := us.valueMap[val]
-	return ok
+	us.m.RLock()
+	defer us.m.RUnlock()
+
+	return us.values.Has(val)
 }
 
 func (us *SortedStringSet) Add(val string) bool {
-	_, ok := us.valueMap[val]
-	if ok {
+	us.m.Lock()
+	added := us.values.Insert(val)
+	us.m.Unlock()
+	if !added {
 		return false
 	}
 
-	us.valueMap[val] = nil
-	us.values = append(us.values, val)
-
-	slices.Sort(us.values)
-
-	for _, onAdd := range us.onAdd {
+	for _, onAdd := range us.listeners(&us.onAdd) {
 		onAdd(val)
 	}
 
@@ -65,18 +89,14 @@ func (us *SortedStringSet) Add(val string) bool {
 }
 
 func (us *SortedStringSet) Remove(val string) bool {
-	_, ok := us.valueMap[val]
-	if !ok {
+	us.m.Lock()
+	removed := us.values.Remove(val)
+	us.m.Unlock()
+	if !removed {
 		return false
 	}
 
-	delete(us.valueMap, val)
-
-	us.values = slices.DeleteFunc(us.values, func(s string) bool {
-		return s == val
-	})
-
-	for _, onRemove := range us.onRemove {
+	for _, onRemove := range us.listeners(&us.onRemove) {
 		onRemove(val)
 	}
 
@@ -84,15 +104,36 @@ func (us *SortedStringSet) Remove(val string) bool {
 }
 
 func (us *SortedStringSet) RemoveAll() {
-	for _, value := range us.values {
-		us.Remove(value)
+	us.m.Lock()
+	removed := us.values.Values()
+	us.values = treap.StringTreap{}
+	us.m.Unlock()
+
+	listeners := us.listeners(&us.onRemove)
+	for _, value := range removed {
+		for _, onRemove := range listeners {
+			onRemove(value)
+		}
 	}
 }
 
+func (us *SortedStringSet) listeners(l *[]func(string)) []func(string) {
+	us.listenersMutex.Lock()
+	defer us.listenersMutex.Unlock()
+
+	return slices.Clone(*l)
+}
+
 func (us *SortedStringSet) AddAddEventListener(f func(string)) {
+	us.listenersMutex.Lock()
+	defer us.listenersMutex.Unlock()
+
 	us.onAdd = append(us.onAdd, f)
 }
 func (us *SortedStringSet) AddRemoveEventListener(f func(string)) {
+	us.listenersMutex.Lock()
+	defer us.listenersMutex.Unlock()
+
 	us.onRemove = append(us.onRemove, f)
 }
 func (us *SortedStringSet) AddChangeEventListener(f func()) {
@@ -1,6 +1,11 @@
 package main_test
 
 import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"testing"
 
 	main "github.com/anton15x/dropbox_ignore_service"
@@ -62,3 +67,102 @@ func TestSortedStringSet(t *testing.T) {
 		})
 	}
 }
+
+func TestSortedStringSetRemoveAll(t *testing.T) {
+	set := main.NewSortedStringSet()
+	var removed []string
+	set.AddRemoveEventListener(func(s string) {
+		removed = append(removed, s)
+	})
+	require.Equal(t, true, set.Add("B"))
+	require.Equal(t, true, set.Add("A"))
+	require.Equal(t, true, set.Add("C"))
+
+	set.RemoveAll()
+	require.Equal(t, []string{}, set.Values())
+	require.Equal(t, []string{"A", "B", "C"}, removed)
+	require.Equal(t, false, set.Has("A"))
+	require.Equal(t, true, set.Add("A"))
+}
+
+// run with -race
+func TestSortedStringSetConcurrent(t *testing.T) {
+	set := main.NewSortedStringSet()
+	var listenerCalls atomic.Int64
+	set.AddChangeEventListener(func() {
+		// listeners are called without holding the lock
+		set.Len()
+		listenerCalls.Add(1)
+	})
+
+	const goroutines = 8
+	const values = 200
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		g := g
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < values; i++ {
+				val := fmt.Sprintf("%d/%03d", g, i)
+				require.Equal(t, true, set.Add(val))
+				require.Equal(t, true, set.Has(val))
+				set.GetOrEmptyString(i)
+				values := set.Values()
+				require.True(t, slices.IsSorted(values))
+				if i%2 == 0 {
+					require.Equal(t, true, set.Remove(val))
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	require.Equal(t, goroutines*values/2, set.Len())
+	require.Equal(t, int64(goroutines*values*3/2), listenerCalls.Load())
+	require.True(t, slices.IsSorted(set.Values()))
+}
+
+func TestSortedStringSetValuesWithPrefix(t *testing.T) {
+	set := main.NewSortedStringSet()
+	for _, val := range []string{"/a", "/a/b", "/a/b/c", "/a/c", "/ab", "/b", "/b/a"} {
+		require.Equal(t, true, set.Add(val))
+	}
+
+	require.Equal(t, []string{"/a/b", "/a/b/c", "/a/c"}, set.ValuesWithPrefix("/a/"))
+	require.Equal(t, []string{"/a", "/a/b", "/a/b/c", "/a/c", "/ab"}, set.ValuesWithPrefix("/a"))
+	require.Equal(t, []string{"/b/a"}, set.ValuesWithPrefix("/b/"))
+	require.Equal(t, []string{}, set.ValuesWithPrefix("/c"))
+	require.Equal(t, set.Values(), set.ValuesWithPrefix(""))
+}
+
+func TestSortedStringSetLarge(t *testing.T) {
+	const count = 100000
+	set := main.NewSortedStringSet()
+	var expected []string
+	// insert in walk order and in random order
+	for i := 0; i < count; i++ {
+		val := fmt.Sprintf("/dropbox/%06d/node_modules", i)
+		expected = append(expected, val)
+		require.Equal(t, true, set.Add(val))
+	}
+	r := rand.New(rand.NewSource(1))
+	for _, i := range r.Perm(count) {
+		val := fmt.Sprintf("/dropbox/%06d/.git", i)
+		expected = append(expected, val)
+		require.Equal(t, true, set.Add(val))
+	}
+	slices.Sort(expected)
+	require.Equal(t, expected, set.Values())
+	for _, i := range []int{0, 1, count, 2*count - 1} {
+		require.Equal(t, expected[i], set.Get(i))
+	}
+	require.Equal(t, "", set.GetOrEmptyString(2*count))
+
+	for _, i := range r.Perm(count) {
+		require.Equal(t, true, set.Remove(fmt.Sprintf("/dropbox/%06d/.git", i)))
+	}
+	require.Equal(t, count, set.Len())
+	require.Equal(t, []string{"/dropbox/000042/node_modules"}, set.ValuesWithPrefix("/dropbox/000042/"))
+	require.Equal(t, false, set.Remove("/dropbox/000042/.git"))
+}
@@ -0,0 +1,16 @@
+package fsnotify
+
+import (
+	"io/fs"
+	"syscall"
+	"time"
+)
+
+// changeTime returns the ctime, it changes with the extended attributes as well
+func changeTime(info fs.FileInfo) time.Time {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return time.Time{}
+	}
+	return time.Unix(stat.Ctimespec.Unix())
+}
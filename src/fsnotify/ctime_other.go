@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+
+package fsnotify
+
+import (
+	"io/fs"
+	"time"
+)
+
+// changeTime is not available, the polling watcher only reports mode changes as chmod
+func changeTime(info fs.FileInfo) time.Time {
+	return time.Time{}
+}
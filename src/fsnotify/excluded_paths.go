@@ -0,0 +1,65 @@
+package fsnotify
+
+import "path/filepath"
+
+// excludedPaths is not thread safe, the watchers guard it with their own mutex
+type excludedPaths struct {
+	paths map[string]interface{}
+}
+
+func newExcludedPaths() *excludedPaths {
+	return &excludedPaths{
+		paths: map[string]interface{}{},
+	}
+}
+
+func (e *excludedPaths) Add(path string) bool {
+	_, ok := e.paths[path]
+	if ok {
+		return false
+	}
+	e.paths[path] = nil
+	return true
+}
+
+func (e *excludedPaths) Remove(path string) bool {
+	_, ok := e.paths[path]
+	if !ok {
+		return false
+	}
+	delete(e.paths, path)
+	return true
+}
+
+func (e *excludedPaths) Clone() *excludedPaths {
+	clone := newExcludedPaths()
+	for path := range e.paths {
+		clone.paths[path] = nil
+	}
+	return clone
+}
+
+func (e *excludedPaths) Has(path string) bool {
+	_, ok := e.paths[path]
+	return ok
+}
+
+// IsInside reports if path is located below any excluded path (the excluded path itself is not inside)
+func (e *excludedPaths) IsInside(path string) bool {
+	if len(e.paths) == 0 {
+		return false
+	}
+
+	currentDir := path
+	for {
+		newDir := filepath.Dir(currentDir)
+		if newDir == currentDir {
+			return false
+		}
+		currentDir = newDir
+
+		if e.Has(currentDir) {
+			return true
+		}
+	}
+}
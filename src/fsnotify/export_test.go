@@ -0,0 +1,5 @@
+package fsnotify
+
+func RelayEvents[T any](src <-chan T, dst chan<- T, done <-chan struct{}, overflow func()) {
+	relayEvents(src, dst, done, overflow)
+}
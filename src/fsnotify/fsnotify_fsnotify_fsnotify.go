@@ -11,21 +11,10 @@ import (
 	"strings"
 	"sync"
 
+	"github.com/anton15x/dropbox_ignore_service/src/treap"
 	"github.com/fsnotify/fsnotify"
 )
 
-type Watcher struct {
-	Events <-chan Event
-	Errors <-chan error
-
-	w *fsnotify.Watcher
-}
-
-type Event struct {
-	Name string
-	Op   Op
-}
-
 type Op fsnotify.Op
 
 const (
@@ -33,8 +22,10 @@ const (
 	Remove Op = Op(fsnotify.Remove)
 	Write  Op = Op(fsnotify.Write)
 	Rename Op = Op(fsnotify.Rename)
+	// Chmod is reported for changed permissions, timestamps and extended attributes
+	Chmod Op = Op(fsnotify.Chmod)
 
-	All Op = Create | Remove | Write | Rename
+	All Op = Create | Remove | Write | Rename | Chmod
 )
 
 func (e *Op) String() string {
@@ -51,20 +42,31 @@ func GetFileNameEndingWithSeparator(path string) string {
 	return path
 }
 
-func NewWatcherRecursive(rootPath string) (*Watcher, error) {
-	w, err := fsnotify.NewBufferedWatcher(1000)
+func newNativeWatcherRecursive(rootPath string, options Options) (*Watcher, error) {
+	w, err := fsnotify.NewBufferedWatcher(uint(options.BufferSize))
 	if err != nil {
 		return nil, fmt.Errorf("error creating watcher: %w", err)
 	}
 
-	f := make(chan Event, 1000)
-	errChan := make(chan error, 1000)
+	f := make(chan Event, options.BufferSize)
+	errChan := make(chan error, options.BufferSize)
+	// done unblocks the goroutines, if nobody reads the channels anymore after close
+	done := make(chan struct{})
 	var errWg sync.WaitGroup
+	sendErr := func(err error) {
+		select {
+		case errChan <- err:
+		case <-done:
+		}
+	}
 
-	watchedPaths := map[string]interface{}{}
+	// watchedPaths and excludedPaths are used by the event goroutine and by Exclude/Include
+	var m sync.Mutex
+	// sorted => the watched paths inside a removed directory are a range
+	var watchedPaths treap.StringTreap
+	excludedPaths := newExcludedPaths()
 	addPath := func(path string) error {
-		_, ok := watchedPaths[path]
-		if ok {
+		if watchedPaths.Has(path) {
 			return nil
 		}
 
@@ -76,7 +78,7 @@ func NewWatcherRecursive(rootPath string) (*Watcher, error) {
 
 			return err
 		}
-		watchedPaths[path] = nil
+		watchedPaths.Insert(path)
 
 		return nil
 	}
@@ -87,6 +89,10 @@ func NewWatcherRecursive(rootPath string) (*Watcher, error) {
 			}
 
 			if d.IsDir() {
+				if excludedPaths.Has(path) {
+					return filepath.SkipDir
+				}
+
 				err = addPath(path)
 				if err != nil {
 					return fmt.Errorf("error adding path %s to watcher: %w", path, err)
@@ -103,39 +109,30 @@ func NewWatcherRecursive(rootPath string) (*Watcher, error) {
 		}
 		return nil
 	}
-	removePathSingle := func(path string) error {
+	removeWatch := func(path string) error {
 		err := w.Remove(path)
 		if err != nil && !errors.Is(err, fsnotify.ErrNonExistentWatch) {
 			return err
 		}
-		delete(watchedPaths, path)
 		return nil
 	}
 	removePathRecursive := func(path string) error {
-		_, ok := watchedPaths[path]
-		if ok {
-			err := removePathSingle(path)
-			if err != nil {
-				return err
-			}
+		var errs []error
+		if watchedPaths.Remove(path) {
+			errs = append(errs, removeWatch(path))
 		}
-
-		pathWithSeparator := GetFileNameEndingWithSeparator(path)
-
-		for key := range watchedPaths {
-			if strings.HasPrefix(key, pathWithSeparator) {
-				err := removePathSingle(key)
-				if err != nil {
-					return err
-				}
-			}
+		for _, key := range watchedPaths.RemovePrefix(GetFileNameEndingWithSeparator(path)) {
+			errs = append(errs, removeWatch(key))
 		}
-
-		return nil
+		return errors.Join(errs...)
 	}
 
 	err = addPathRecursive(rootPath)
 	if err != nil {
+		closeErr := w.Close()
+		if closeErr != nil {
+			err = errors.Join(err, closeErr)
+		}
 		return nil, fmt.Errorf("error walking path %s: %w", rootPath, err)
 	}
 
@@ -153,21 +150,35 @@ func NewWatcherRecursive(rootPath string) (*Watcher, error) {
 					Op:   Op(val.Op),
 				}
 
+				m.Lock()
+				if excludedPaths.IsInside(e.Name) {
+					// event was queued before the subtree got excluded
+					m.Unlock()
+					continue
+				}
 				if e.Op.Has(Create) || e.Op.Has(Rename) || e.Op.Has(Remove) {
 					err := removePathRecursive(e.Name)
 					if err != nil {
-						errChan <- fmt.Errorf("error removing path %s after event %s: %w", e.Name, e.Op.String(), err)
+						sendErr(fmt.Errorf("error removing path %s after event %s: %w", e.Name, e.Op.String(), err))
 					}
 				}
 				if (e.Op.Has(Create) || e.Op.Has(Rename) || e.Op.Has(Remove)) && strings.HasPrefix(e.Name, rootPathWithSeparator) {
 					// event order cloud be incorrect => try add folder also at remove
-					err = addPathRecursive(e.Name)
+					err := addPathRecursive(e.Name)
 					if err != nil {
-						errChan <- fmt.Errorf("error adding path %s after event %s: %w", e.Name, e.Op.String(), err)
+						sendErr(fmt.Errorf("error adding path %s after event %s: %w", e.Name, e.Op.String(), err))
 					}
 				}
+				m.Unlock()
 
-				f <- e
+				if !options.filter(&e) {
+					continue
+				}
+				select {
+				case f <- e:
+				case <-done:
+					return
+				}
 			} else {
 				break
 			}
@@ -180,7 +191,10 @@ func NewWatcherRecursive(rootPath string) (*Watcher, error) {
 		for {
 			val, ok := <-w.Errors
 			if ok {
-				errChan <- val
+				if errors.Is(val, fsnotify.ErrEventOverflow) {
+					val = fmt.Errorf("%w: %s", ErrEventOverflow, rootPath)
+				}
+				sendErr(val)
 			} else {
 				break
 			}
@@ -191,19 +205,41 @@ func NewWatcherRecursive(rootPath string) (*Watcher, error) {
 		close(errChan)
 	}()
 
+	var closeOnce sync.Once
 	return &Watcher{
 		Events: f,
 		Errors: errChan,
 
-		w: w,
-	}, nil
-}
+		backend: BackendNative,
 
-func (w *Watcher) Close() error {
-	err := w.w.Close()
-	if err != nil {
-		return fmt.Errorf("error closing watcher: %w", err)
-	}
+		close: func() error {
+			closeOnce.Do(func() {
+				close(done)
+			})
+			return w.Close()
+		},
+		exclude: func(path string) error {
+			m.Lock()
+			defer m.Unlock()
 
-	return nil
+			if !excludedPaths.Add(path) {
+				return nil
+			}
+			// the excluded path itself stays reported by the watch of its parent
+			return removePathRecursive(path)
+		},
+		include: func(path string) error {
+			m.Lock()
+			defer m.Unlock()
+
+			if !excludedPaths.Remove(path) {
+				return nil
+			}
+			if excludedPaths.IsInside(path) {
+				// still inside another excluded path
+				return nil
+			}
+			return addPathRecursive(path)
+		},
+	}, nil
 }
@@ -0,0 +1,205 @@
+package fsnotify
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+type pollingFileState struct {
+	isDir   bool
+	size    int64
+	modTime time.Time
+	// changeTime changes with the extended attributes, e.g. the ignore flag of dropbox
+	changeTime time.Time
+	mode       fs.FileMode
+}
+
+type pollingSnapshot map[string]pollingFileState
+
+func newPollingWatcherRecursive(rootPath string, options Options) (*Watcher, error) {
+	// excluded is used by the polling goroutine and by Exclude/Include
+	var m sync.Mutex
+	excluded := newExcludedPaths()
+
+	getExcludedPaths := func() *excludedPaths {
+		m.Lock()
+		defer m.Unlock()
+
+		return excluded.Clone()
+	}
+
+	takeSnapshot := func(excludedPaths *excludedPaths) (pollingSnapshot, error) {
+		snapshot := pollingSnapshot{}
+		err := filepath.WalkDir(rootPath, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			if path == rootPath {
+				return nil
+			}
+
+			info, err := d.Info()
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			snapshot[path] = pollingFileState{
+				isDir:      d.IsDir(),
+				size:       info.Size(),
+				modTime:    info.ModTime(),
+				changeTime: changeTime(info),
+				mode:       info.Mode(),
+			}
+
+			if d.IsDir() && excludedPaths.Has(path) {
+				return filepath.SkipDir
+			}
+			return nil
+		})
+		if err != nil {
+			return snapshot, fmt.Errorf("error walking path %s: %w", rootPath, err)
+		}
+		return snapshot, nil
+	}
+
+	snapshot, err := takeSnapshot(getExcludedPaths())
+	if err != nil {
+		return nil, err
+	}
+
+	f := make(chan Event, options.BufferSize)
+	errChan := make(chan error, options.BufferSize)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(errChan)
+		defer close(f)
+
+		ticker := time.NewTicker(options.PollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			excludedPaths := getExcludedPaths()
+			newSnapshot, err := takeSnapshot(excludedPaths)
+			if err != nil {
+				select {
+				case errChan <- err:
+				case <-done:
+					return
+				}
+				// the snapshot is incomplete => do not report the missing paths as removed
+				continue
+			}
+
+			for _, e := range diffPollingSnapshots(snapshot, newSnapshot) {
+				if excludedPaths.IsInside(e.Name) {
+					// got excluded since the last snapshot
+					continue
+				}
+				if !options.filter(&e) {
+					continue
+				}
+				select {
+				case f <- e:
+				case <-done:
+					return
+				}
+			}
+			snapshot = newSnapshot
+		}
+	}()
+
+	var closeOnce sync.Once
+	return &Watcher{
+		Events: f,
+		Errors: errChan,
+
+		backend: BackendPolling,
+
+		close: func() error {
+			closeOnce.Do(func() {
+				close(done)
+			})
+			wg.Wait()
+			return nil
+		},
+		exclude: func(path string) error {
+			m.Lock()
+			defer m.Unlock()
+
+			excluded.Add(path)
+			return nil
+		},
+		include: func(path string) error {
+			m.Lock()
+			defer m.Unlock()
+
+			excluded.Remove(path)
+			return nil
+		},
+	}, nil
+}
+
+// diffPollingSnapshots creates the events, that lead from the old to the new snapshot.
+// A rename is reported as remove of the old and create of the new path.
+func diffPollingSnapshots(oldSnapshot pollingSnapshot, newSnapshot pollingSnapshot) []Event {
+	// a changed ctime without a changed mtime is a change of the mode or the extended attributes
+	var removed, created, written, modeChanged []string
+	for path, oldState := range oldSnapshot {
+		newState, ok := newSnapshot[path]
+		if !ok || newState.isDir != oldState.isDir {
+			removed = append(removed, path)
+		}
+	}
+	for path, newState := range newSnapshot {
+		oldState, ok := oldSnapshot[path]
+		if !ok || newState.isDir != oldState.isDir {
+			created = append(created, path)
+		} else if !newState.isDir && (newState.size != oldState.size || !newState.modTime.Equal(oldState.modTime)) {
+			written = append(written, path)
+		} else if newState.mode != oldState.mode || (newState.modTime.Equal(oldState.modTime) && !newState.changeTime.Equal(oldState.changeTime)) {
+			modeChanged = append(modeChanged, path)
+		}
+	}
+
+	// parents are created before and removed after their children
+	slices.Sort(removed)
+	slices.Reverse(removed)
+	slices.Sort(created)
+	slices.Sort(written)
+	slices.Sort(modeChanged)
+
+	events := make([]Event, 0, len(removed)+len(created)+len(written)+len(modeChanged))
+	for _, path := range removed {
+		events = append(events, Event{Name: path, Op: Remove})
+	}
+	for _, path := range created {
+		events = append(events, Event{Name: path, Op: Create})
+	}
+	for _, path := range written {
+		events = append(events, Event{Name: path, Op: Write})
+	}
+	for _, path := range modeChanged {
+		events = append(events, Event{Name: path, Op: Chmod})
+	}
+	return events
+}
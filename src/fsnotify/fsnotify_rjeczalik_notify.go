@@ -5,23 +5,11 @@ package fsnotify
 import (
 	"fmt"
 	"path/filepath"
+	"sync"
 
 	"github.com/rjeczalik/notify"
 )
 
-type Watcher struct {
-	Events <-chan Event
-	Errors <-chan error
-
-	errChan          chan error
-	modificationChan chan notify.EventInfo
-}
-
-type Event struct {
-	Name string
-	Op   Op
-}
-
 type Op notify.Event
 
 const (
@@ -29,8 +17,10 @@ const (
 	Remove Op = Op(notify.Remove)
 	Write  Op = Op(notify.Write)
 	Rename Op = Op(notify.Rename)
+	// Chmod is reported for changed attributes and alternate data streams, windows reports them as modification
+	Chmod Op = Op(notify.FileActionModified)
 
-	All Op = Create | Remove | Write | Rename
+	All Op = Create | Remove | Write | Rename | Chmod
 )
 
 func (e *Op) String() string {
@@ -40,42 +30,105 @@ func (e *Op) Has(h Op) bool {
 	return (*e)&h != 0
 }
 
-func NewWatcherRecursive(path string) (*Watcher, error) {
-	errChan := make(chan error)
-	modificationChan := make(chan notify.EventInfo, 1000)
-
-	err := notify.Watch(filepath.Join(path, "..."), modificationChan, notify.Create|notify.Rename|notify.Remove|notify.Write)
+func newNativeWatcherRecursive(path string, options Options) (*Watcher, error) {
+	errChan := make(chan error, options.BufferSize)
+	// notify drops an event silently if its channel is full => it writes to a channel, that is drained by relayEvents,
+	// which detects the overflow of modificationChan
+	notifyChan := make(chan notify.EventInfo, options.BufferSize)
+	modificationChan := make(chan notify.EventInfo, options.BufferSize)
+	overflow := make(chan struct{}, 1)
+	done := make(chan struct{})
+
+	watchEvents := notify.Event(options.Ops &^ Chmod)
+	if options.Ops.Has(Chmod) {
+		// only the windows specific filter reports attribute changes
+		watchEvents |= notify.FileNotifyChangeAttributes
+	}
+	err := notify.Watch(filepath.Join(path, "..."), notifyChan, watchEvents)
 	if err != nil {
 		return nil, fmt.Errorf("error watching files: %s", err)
 	}
 
-	f := make(chan Event, 1000)
+	// notify watches recursive by itself => excluded paths can only get filtered
+	var m sync.Mutex
+	excludedPaths := newExcludedPaths()
+	isExcluded := func(path string) bool {
+		m.Lock()
+		defer m.Unlock()
+
+		return excludedPaths.IsInside(path)
+	}
+
+	go relayEvents(notifyChan, modificationChan, done, func() {
+		select {
+		case overflow <- struct{}{}:
+		default:
+		}
+	})
+
+	f := make(chan Event, options.BufferSize)
 	go func() {
+		defer close(errChan)
 		defer close(f)
 		for {
-			val, ok := <-modificationChan
-			if ok {
-				f <- Event{
-					Name: val.Path(),
-					Op:   Op(val.Event()),
+			var val notify.EventInfo
+			select {
+			case <-done:
+				return
+			case <-overflow:
+				select {
+				case errChan <- fmt.Errorf("%w: %s", ErrEventOverflow, path):
+				default:
 				}
-			} else {
-				break
+				continue
+			case val = <-modificationChan:
+			}
+
+			if isExcluded(val.Path()) {
+				continue
+			}
+			e := Event{
+				Name: val.Path(),
+				Op:   Op(val.Event()),
+			}
+			if !options.filter(&e) {
+				continue
+			}
+			select {
+			case <-done:
+				return
+			case f <- e:
 			}
 		}
 	}()
 
+	var closeOnce sync.Once
 	return &Watcher{
 		Events: f,
 		Errors: errChan,
 
-		errChan:          errChan,
-		modificationChan: modificationChan,
+		backend: BackendNative,
+
+		close: func() error {
+			closeOnce.Do(func() {
+				notify.Stop(notifyChan)
+				close(done)
+			})
+			return nil
+		},
+		exclude: func(path string) error {
+			m.Lock()
+			defer m.Unlock()
+
+			excludedPaths.Add(path)
+			return nil
+		},
+		include: func(path string) error {
+			m.Lock()
+			defer m.Unlock()
+
+			excludedPaths.Remove(path)
+			return nil
+		},
 	}, nil
 }
-
-func (w *Watcher) Close() error {
-	notify.Stop(w.modificationChan)
-	close(w.errChan)
-	return nil
-}
@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/anton15x/dropbox_ignore_service/src/fsnotify"
 	"github.com/stretchr/testify/require"
@@ -33,15 +34,30 @@ func WaitForEvent(t *testing.T, w *fsnotify.Watcher, name string, op fsnotify.Op
 	}
 }
 
+var testBackends = []fsnotify.Options{
+	{Backend: fsnotify.BackendNative},
+	{Backend: fsnotify.BackendPolling, PollInterval: 50 * time.Millisecond},
+}
+
 func TestNewWatcherRecursive(t *testing.T) {
+	for _, options := range testBackends {
+		options := options
+		t.Run(string(options.Backend), func(t *testing.T) {
+			testNewWatcherRecursive(t, options)
+		})
+	}
+}
+
+func testNewWatcherRecursive(t *testing.T, options fsnotify.Options) {
 	tmpDir := t.TempDir()
 
 	rootWatchDir, err := os.MkdirTemp(tmpDir, "a")
 	requireNoError(t, err)
 
-	w, err := fsnotify.NewWatcherRecursive(rootWatchDir)
+	w, err := fsnotify.NewWatcherRecursiveWithOptions(rootWatchDir, options)
 	requireNoError(t, err)
 	require.NotNil(t, w)
+	require.Equal(t, options.Backend, w.Backend())
 
 	// crete tests
 
@@ -86,3 +102,173 @@ func TestNewWatcherRecursive(t *testing.T) {
 	requireNoError(t, err)
 	require.False(t, ok)
 }
+
+func TestWatcherExclude(t *testing.T) {
+	for _, options := range testBackends {
+		options := options
+		t.Run(string(options.Backend), func(t *testing.T) {
+			testWatcherExclude(t, options)
+		})
+	}
+}
+
+func testWatcherExclude(t *testing.T, options fsnotify.Options) {
+	tmpDir := t.TempDir()
+
+	rootWatchDir, err := os.MkdirTemp(tmpDir, "a")
+	requireNoError(t, err)
+
+	excludedDir := filepath.Join(rootWatchDir, "node_modules")
+	requireNoError(t, os.MkdirAll(filepath.Join(excludedDir, "a"), os.ModePerm))
+
+	w, err := fsnotify.NewWatcherRecursiveWithOptions(rootWatchDir, options)
+	requireNoError(t, err)
+	require.NotNil(t, w)
+
+	requireNoError(t, w.Exclude(excludedDir))
+
+	// events below the excluded dir are not reported, the next event has to be the one outside
+	requireNoError(t, os.Mkdir(filepath.Join(excludedDir, "b"), os.ModePerm))
+	requireNoError(t, os.Mkdir(filepath.Join(excludedDir, "a", "c"), os.ModePerm))
+	requireNoError(t, os.Mkdir(filepath.Join(rootWatchDir, "x"), os.ModePerm))
+	e := <-w.Events
+	require.Equal(t, filepath.Join(rootWatchDir, "x"), e.Name)
+
+	// the excluded dir itself is still reported
+	requireNoError(t, os.Rename(excludedDir, filepath.Join(rootWatchDir, "y")))
+	// polling reports the old name of a rename as remove
+	WaitForEvent(t, w, excludedDir, fsnotify.Rename|fsnotify.Remove)
+	requireNoError(t, os.Rename(filepath.Join(rootWatchDir, "y"), excludedDir))
+	WaitForEvent(t, w, excludedDir, fsnotify.Create)
+
+	requireNoError(t, w.Include(excludedDir))
+
+	requireNoError(t, os.Mkdir(filepath.Join(excludedDir, "a", "d"), os.ModePerm))
+	WaitForEvent(t, w, filepath.Join(excludedDir, "a", "d"), fsnotify.Create)
+
+	err = w.Close()
+	requireNoError(t, err)
+}
+
+func TestWatcherFilter(t *testing.T) {
+	for _, options := range testBackends {
+		options := options
+		t.Run(string(options.Backend), func(t *testing.T) {
+			options.Ops = fsnotify.Create
+			options.BufferSize = 10
+			options.Filter = func(path string, op fsnotify.Op) bool {
+				return filepath.Base(path) != "skipped"
+			}
+			testWatcherFilter(t, options)
+		})
+	}
+}
+
+func testWatcherFilter(t *testing.T, options fsnotify.Options) {
+	tmpDir := t.TempDir()
+
+	rootWatchDir, err := os.MkdirTemp(tmpDir, "a")
+	requireNoError(t, err)
+
+	w, err := fsnotify.NewWatcherRecursiveWithOptions(rootWatchDir, options)
+	requireNoError(t, err)
+	require.NotNil(t, w)
+
+	// filtered directories are watched anyway
+	requireNoError(t, os.Mkdir(filepath.Join(rootWatchDir, "skipped"), os.ModePerm))
+	requireNoError(t, os.Mkdir(filepath.Join(rootWatchDir, "a"), os.ModePerm))
+	e := <-w.Events
+	require.Equal(t, filepath.Join(rootWatchDir, "a"), e.Name)
+	requireNoError(t, os.Mkdir(filepath.Join(rootWatchDir, "skipped", "a"), os.ModePerm))
+	e = <-w.Events
+	require.Equal(t, filepath.Join(rootWatchDir, "skipped", "a"), e.Name)
+	require.Equal(t, fsnotify.Create, e.Op)
+
+	requireNoError(t, os.WriteFile(filepath.Join(rootWatchDir, "file"), []byte("a"), os.ModePerm))
+	e = <-w.Events
+	require.Equal(t, filepath.Join(rootWatchDir, "file"), e.Name)
+	require.Equal(t, fsnotify.Create, e.Op)
+
+	// write and remove are not part of the ops
+	requireNoError(t, os.WriteFile(filepath.Join(rootWatchDir, "file"), []byte("ab"), os.ModePerm))
+	requireNoError(t, os.Remove(filepath.Join(rootWatchDir, "skipped", "a")))
+	requireNoError(t, os.Mkdir(filepath.Join(rootWatchDir, "b"), os.ModePerm))
+	e = <-w.Events
+	require.Equal(t, filepath.Join(rootWatchDir, "b"), e.Name)
+	require.Equal(t, fsnotify.Create, e.Op)
+
+	err = w.Close()
+	requireNoError(t, err)
+}
+
+func TestWatcherChmod(t *testing.T) {
+	for _, options := range testBackends {
+		options := options
+		t.Run(string(options.Backend), func(t *testing.T) {
+			testWatcherChmod(t, options)
+		})
+	}
+}
+
+func testWatcherChmod(t *testing.T, options fsnotify.Options) {
+	tmpDir := t.TempDir()
+
+	rootWatchDir, err := os.MkdirTemp(tmpDir, "a")
+	requireNoError(t, err)
+	file := filepath.Join(rootWatchDir, "file")
+	requireNoError(t, os.WriteFile(file, []byte("a"), 0o644))
+
+	w, err := fsnotify.NewWatcherRecursiveWithOptions(rootWatchDir, options)
+	requireNoError(t, err)
+	require.NotNil(t, w)
+
+	requireNoError(t, os.Chmod(file, 0o600))
+	WaitForEvent(t, w, file, fsnotify.Chmod)
+
+	err = w.Close()
+	requireNoError(t, err)
+}
+
+func TestParseBackend(t *testing.T) {
+	for _, backend := range fsnotify.Backends {
+		parsed, err := fsnotify.ParseBackend(string(backend))
+		requireNoError(t, err)
+		require.Equal(t, backend, parsed)
+	}
+
+	_, err := fsnotify.ParseBackend("inotify")
+	require.NotNil(t, err)
+}
+
+func TestRelayEventsOverflow(t *testing.T) {
+	src := make(chan int)
+	dst := make(chan int, 1)
+	done := make(chan struct{})
+	overflows := make(chan struct{}, 2)
+	go fsnotify.RelayEvents(src, dst, done, func() {
+		overflows <- struct{}{}
+	})
+	defer close(done)
+
+	for i := 1; i <= 3; i++ {
+		src <- i
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case <-overflows:
+		case <-time.After(time.Second):
+			t.Fatalf("overflow %d not reported", i+1)
+		}
+	}
+	require.Equal(t, 1, <-dst)
+
+	// after the consumer caught up, the events are relayed again
+	src <- 4
+	select {
+	case val := <-dst:
+		require.Equal(t, 4, val)
+	case <-time.After(time.Second):
+		t.Fatal("event not relayed")
+	}
+	require.Len(t, overflows, 0)
+}
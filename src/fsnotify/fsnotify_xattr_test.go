@@ -0,0 +1,34 @@
+//go:build !windows
+
+package fsnotify_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/anton15x/dropbox_ignore_service/src/fsnotify"
+	"github.com/pkg/xattr"
+)
+
+// TestWatcherXattr checks the chmod event of the dropbox ignore flag
+func TestWatcherXattr(t *testing.T) {
+	for _, options := range testBackends {
+		options := options
+		t.Run(string(options.Backend), func(t *testing.T) {
+			rootWatchDir := t.TempDir()
+			dir := filepath.Join(rootWatchDir, "node_modules")
+			requireNoError(t, os.Mkdir(dir, os.ModePerm))
+
+			w, err := fsnotify.NewWatcherRecursiveWithOptions(rootWatchDir, options)
+			requireNoError(t, err)
+
+			requireNoError(t, xattr.Set(dir, "user.com.dropbox.ignored", []byte("1")))
+			WaitForEvent(t, w, dir, fsnotify.Chmod)
+			requireNoError(t, xattr.Remove(dir, "user.com.dropbox.ignored"))
+			WaitForEvent(t, w, dir, fsnotify.Chmod)
+
+			requireNoError(t, w.Close())
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package fsnotify
+
+import (
+	"strings"
+	"syscall"
+)
+
+// filesystems where FSEvents does not report changes made by other hosts (or does not work at all)
+var pollingFilesystemTypes = []string{
+	"nfs",
+	"smbfs",
+	"afpfs",
+	"webdav",
+	"macfuse",
+	"osxfuse",
+	"fuse",
+}
+
+func pollingFilesystemType(path string) (string, bool, error) {
+	var stat syscall.Statfs_t
+	err := syscall.Statfs(path, &stat)
+	if err != nil {
+		return "", false, err
+	}
+
+	var name strings.Builder
+	for _, c := range stat.Fstypename {
+		if c == 0 {
+			break
+		}
+		name.WriteByte(byte(c))
+	}
+
+	for _, fsType := range pollingFilesystemTypes {
+		if name.String() == fsType {
+			return name.String(), true, nil
+		}
+	}
+	return name.String(), false, nil
+}
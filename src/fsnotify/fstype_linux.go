@@ -0,0 +1,37 @@
+package fsnotify
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// filesystems where inotify does not report changes made by other hosts (or does not work at all)
+// magic numbers: see statfs(2) and linux/magic.h
+var pollingFilesystemTypes = map[uint32]string{
+	0x6969:     "nfs",
+	0x517b:     "smb",
+	0xff534d42: "cifs",
+	0xfe534d42: "smb2",
+	0x65735546: "fuse",
+	0x01021997: "v9fs",
+	0x564c:     "ncp",
+	0x5346414f: "afs",
+	0x6b414653: "kafs",
+	0x47504653: "gpfs",
+	0x0bd00bd0: "lustre",
+}
+
+func pollingFilesystemType(path string) (string, bool, error) {
+	var stat syscall.Statfs_t
+	err := syscall.Statfs(path, &stat)
+	if err != nil {
+		return "", false, err
+	}
+
+	fsType := uint32(stat.Type)
+	name, ok := pollingFilesystemTypes[fsType]
+	if !ok {
+		return fmt.Sprintf("0x%x", fsType), false, nil
+	}
+	return name, true, nil
+}
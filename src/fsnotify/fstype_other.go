@@ -0,0 +1,7 @@
+//go:build !linux && !darwin
+
+package fsnotify
+
+func pollingFilesystemType(path string) (string, bool, error) {
+	return "", false, nil
+}
@@ -0,0 +1,19 @@
+package fsnotify
+
+// relayEvents moves the events of src to dst until done is closed.
+// The send to dst does not block, so src is drained as fast as the backend writes it.
+// If dst is full, the event is dropped and overflow is called.
+func relayEvents[T any](src <-chan T, dst chan<- T, done <-chan struct{}, overflow func()) {
+	for {
+		select {
+		case <-done:
+			return
+		case val := <-src:
+			select {
+			case dst <- val:
+			default:
+				overflow()
+			}
+		}
+	}
+}
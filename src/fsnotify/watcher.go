@@ -0,0 +1,169 @@
+package fsnotify
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"syscall"
+	"time"
+)
+
+type Watcher struct {
+	Events <-chan Event
+	Errors <-chan error
+
+	backend Backend
+
+	close func() error
+	// exclude and include remove or re-add the watches of a subtree
+	exclude func(path string) error
+	include func(path string) error
+}
+
+type Event struct {
+	Name string
+	Op   Op
+}
+
+// ErrEventOverflow is reported via Watcher.Errors (wrapped), if events got lost.
+// The watched tree has to be rescanned to catch up with the changes.
+var ErrEventOverflow = errors.New("file watcher event queue overflow, events got lost")
+
+type Backend string
+
+const (
+	// BackendAuto uses the native backend, except the filesystem is known to not support it
+	BackendAuto Backend = "auto"
+	// BackendNative uses inotify/kqueue/FSEvents/ReadDirectoryChangesW
+	BackendNative Backend = "native"
+	// BackendPolling compares snapshots of the directory tree, works on NFS/SMB/FUSE mounts as well
+	BackendPolling Backend = "polling"
+)
+
+var Backends = []Backend{BackendAuto, BackendNative, BackendPolling}
+
+func ParseBackend(s string) (Backend, error) {
+	for _, backend := range Backends {
+		if string(backend) == s {
+			return backend, nil
+		}
+	}
+
+	backendNames := make([]string, len(Backends))
+	for i, backend := range Backends {
+		backendNames[i] = string(backend)
+	}
+	return "", fmt.Errorf("unknown watcher backend %q, expected one of: %s", s, strings.Join(backendNames, ", "))
+}
+
+const DefaultPollInterval = 10 * time.Second
+
+const DefaultBufferSize = 1000
+
+type Options struct {
+	// Backend defaults to BackendAuto
+	Backend Backend
+	// PollInterval is the time between two snapshots of the polling backend, defaults to DefaultPollInterval
+	PollInterval time.Duration
+	// Ops are the reported operations, defaults to All
+	Ops Op
+	// BufferSize is the size of the event and error buffers, defaults to DefaultBufferSize
+	BufferSize int
+	// Filter drops events inside the watcher goroutine if it returns false, this lowers the channel pressure at many events.
+	// Watches of new directories are added even if their events get dropped.
+	Filter func(path string, op Op) bool
+}
+
+func (o *Options) setDefaults() {
+	if o.PollInterval <= 0 {
+		o.PollInterval = DefaultPollInterval
+	}
+	if o.Ops == 0 {
+		o.Ops = All
+	}
+	if o.BufferSize <= 0 {
+		o.BufferSize = DefaultBufferSize
+	}
+}
+
+// filter reports if e should get forwarded and removes the not requested operations from it
+func (o *Options) filter(e *Event) bool {
+	e.Op &= o.Ops
+	if e.Op == 0 {
+		return false
+	}
+	if o.Filter != nil && !o.Filter(e.Name, e.Op) {
+		return false
+	}
+	return true
+}
+
+func NewWatcherRecursive(rootPath string) (*Watcher, error) {
+	return NewWatcherRecursiveWithOptions(rootPath, Options{})
+}
+
+func NewWatcherRecursiveWithOptions(rootPath string, options Options) (*Watcher, error) {
+	options.setDefaults()
+
+	switch options.Backend {
+	case BackendNative:
+		return newNativeWatcherRecursive(rootPath, options)
+	case BackendPolling:
+		return newPollingWatcherRecursive(rootPath, options)
+	case BackendAuto, "":
+		fsType, isPollingFsType, err := pollingFilesystemType(rootPath)
+		if err != nil {
+			return nil, fmt.Errorf("error detecting filesystem type of %s: %w", rootPath, err)
+		}
+		if isPollingFsType {
+			return newPollingWatcherRecursive(rootPath, options)
+		}
+
+		w, err := newNativeWatcherRecursive(rootPath, options)
+		if err != nil {
+			if errors.Is(err, syscall.ENOSPC) {
+				// inotify watch limit reached (fs.inotify.max_user_watches)
+				return newPollingWatcherRecursive(rootPath, options)
+			}
+			return nil, fmt.Errorf("error creating native watcher for %s (filesystem type %s): %w", rootPath, fsType, err)
+		}
+		return w, nil
+	default:
+		return nil, fmt.Errorf("unknown watcher backend %q", options.Backend)
+	}
+}
+
+// Backend returns the backend that is used, it is never BackendAuto
+func (w *Watcher) Backend() Backend {
+	return w.backend
+}
+
+func (w *Watcher) Close() error {
+	err := w.close()
+	if err != nil {
+		return fmt.Errorf("error closing watcher: %w", err)
+	}
+
+	return nil
+}
+
+// Exclude stops watching everything below path, e.g. a directory that got the ignore flag.
+// Events for path itself are still reported.
+func (w *Watcher) Exclude(path string) error {
+	err := w.exclude(path)
+	if err != nil {
+		return fmt.Errorf("error excluding path %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// Include reverts Exclude and watches everything below path again.
+func (w *Watcher) Include(path string) error {
+	err := w.include(path)
+	if err != nil {
+		return fmt.Errorf("error including path %s: %w", path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,200 @@
+// Package treap contains the ordered string tree of the sorted sets, it is not thread safe.
+package treap
+
+import (
+	"hash/fnv"
+	"strings"
+)
+
+// StringTreap is an ordered tree with O(log n) insert, remove and access by index.
+// The priority is a hash of the value, so the tree is balanced also for sorted inserts like walked paths.
+type StringTreap struct {
+	root *node
+}
+
+type node struct {
+	value    string
+	priority uint64
+	// size is the number of nodes in the subtree including this node
+	size        int
+	left, right *node
+}
+
+func newNode(value string) *node {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(value))
+	return &node{
+		value:    value,
+		priority: h.Sum64(),
+		size:     1,
+	}
+}
+
+func (n *node) getSize() int {
+	if n == nil {
+		return 0
+	}
+	return n.size
+}
+
+func (n *node) updateSize() {
+	n.size = 1 + n.left.getSize() + n.right.getSize()
+}
+
+// split splits n into the values less than value and the values greater or equal to value
+func split(n *node, value string) (*node, *node) {
+	if n == nil {
+		return nil, nil
+	}
+	if n.value < value {
+		var right *node
+		n.right, right = split(n.right, value)
+		n.updateSize()
+		return n, right
+	}
+	var left *node
+	left, n.left = split(n.left, value)
+	n.updateSize()
+	return left, n
+}
+
+// merge requires all values of left to be less than the values of right
+func merge(left *node, right *node) *node {
+	if left == nil {
+		return right
+	}
+	if right == nil {
+		return left
+	}
+	if left.priority > right.priority {
+		left.right = merge(left.right, right)
+		left.updateSize()
+		return left
+	}
+	right.left = merge(left, right.left)
+	right.updateSize()
+	return right
+}
+
+func (t *StringTreap) Len() int {
+	return t.root.getSize()
+}
+
+func (t *StringTreap) Has(value string) bool {
+	n := t.root
+	for n != nil {
+		switch {
+		case value < n.value:
+			n = n.left
+		case value > n.value:
+			n = n.right
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+// Insert returns false if the value already exists
+func (t *StringTreap) Insert(value string) bool {
+	if t.Has(value) {
+		return false
+	}
+	left, right := split(t.root, value)
+	t.root = merge(merge(left, newNode(value)), right)
+	return true
+}
+
+// Remove returns false if the value does not exist
+func (t *StringTreap) Remove(value string) bool {
+	if !t.Has(value) {
+		return false
+	}
+	left, right := split(t.root, value)
+	// value+"\x00" is the smallest string greater than value
+	_, right = split(right, value+"\x00")
+	t.root = merge(left, right)
+	return true
+}
+
+// Get returns the value at index i of the sorted values
+func (t *StringTreap) Get(i int) (string, bool) {
+	if i < 0 || i >= t.Len() {
+		return "", false
+	}
+	n := t.root
+	for {
+		leftSize := n.left.getSize()
+		switch {
+		case i < leftSize:
+			n = n.left
+		case i > leftSize:
+			i -= leftSize + 1
+			n = n.right
+		default:
+			return n.value, true
+		}
+	}
+}
+
+func (t *StringTreap) Values() []string {
+	return appendValues(make([]string, 0, t.Len()), t.root)
+}
+
+func appendValues(dst []string, n *node) []string {
+	if n == nil {
+		return dst
+	}
+	dst = appendValues(dst, n.left)
+	dst = append(dst, n.value)
+	return appendValues(dst, n.right)
+}
+
+// ValuesWithPrefix returns the sorted values starting with prefix, it only visits the matching subtrees
+func (t *StringTreap) ValuesWithPrefix(prefix string) []string {
+	return appendValuesWithPrefix([]string{}, t.root, prefix)
+}
+
+func appendValuesWithPrefix(dst []string, n *node, prefix string) []string {
+	if n == nil {
+		return dst
+	}
+	// the values with prefix are a continuous range starting at prefix
+	hasPrefix := strings.HasPrefix(n.value, prefix)
+	if n.value >= prefix {
+		dst = appendValuesWithPrefix(dst, n.left, prefix)
+	}
+	if hasPrefix {
+		dst = append(dst, n.value)
+	}
+	if n.value < prefix || hasPrefix {
+		dst = appendValuesWithPrefix(dst, n.right, prefix)
+	}
+	return dst
+}
+
+// RemovePrefix removes the values starting with prefix and returns them sorted, it only visits the matching subtrees
+func (t *StringTreap) RemovePrefix(prefix string) []string {
+	left, right := split(t.root, prefix)
+	var removed *node
+	if end, ok := prefixEnd(prefix); ok {
+		removed, right = split(right, end)
+	} else {
+		removed, right = right, nil
+	}
+	t.root = merge(left, right)
+	return appendValues(make([]string, 0, removed.getSize()), removed)
+}
+
+// prefixEnd returns the smallest string greater than all strings starting with prefix, false if there is none
+func prefixEnd(prefix string) (string, bool) {
+	end := []byte(prefix)
+	for len(end) > 0 && end[len(end)-1] == 0xff {
+		end = end[:len(end)-1]
+	}
+	if len(end) == 0 {
+		return "", false
+	}
+	end[len(end)-1]++
+	return string(end), true
+}
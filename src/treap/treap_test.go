@@ -0,0 +1,38 @@
+package treap_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/anton15x/dropbox_ignore_service/src/treap"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStringTreapRemovePrefix(t *testing.T) {
+	var tr treap.StringTreap
+	for _, val := range []string{"/a", "/a/b", "/a/b/c", "/a/c", "/ab", "/b", "/b/a", "/\xff", "/\xff\xff"} {
+		require.Equal(t, true, tr.Insert(val))
+	}
+
+	require.Equal(t, []string{"/a/b", "/a/b/c", "/a/c"}, tr.RemovePrefix("/a/"))
+	require.Equal(t, []string{"/a", "/ab", "/b", "/b/a", "/\xff", "/\xff\xff"}, tr.Values())
+	require.Equal(t, []string{}, tr.RemovePrefix("/c/"))
+	require.Equal(t, []string{"/\xff", "/\xff\xff"}, tr.RemovePrefix("/\xff"))
+	require.Equal(t, []string{"/a", "/ab", "/b", "/b/a"}, tr.RemovePrefix(""))
+	require.Equal(t, 0, tr.Len())
+}
+
+func TestStringTreapRemovePrefixLarge(t *testing.T) {
+	const count = 100000
+	var tr treap.StringTreap
+	for i := 0; i < count; i++ {
+		require.Equal(t, true, tr.Insert(fmt.Sprintf("/dropbox/%03d/%06d", i%100, i)))
+	}
+
+	removed := tr.RemovePrefix("/dropbox/042/")
+	require.Len(t, removed, count/100)
+	require.Equal(t, "/dropbox/042/000042", removed[0])
+	require.Equal(t, count-count/100, tr.Len())
+	require.Equal(t, false, tr.Has("/dropbox/042/000142"))
+	require.Equal(t, true, tr.Has("/dropbox/043/000143"))
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+)
+
+type unignoreRequest struct {
+	paths  []string
+	result chan unignoreResult
+}
+
+type unignoreResult struct {
+	paths []UnignoredPath
+	err   error
+}
+
+// Unignore removes the ignore flag of the paths inside the dropbox folder.
+// The paths leave the ignored paths first, so the event loop does not set the flag again.
+// The flags are removed by the event loop, it waits until the event loop is running.
+func (i *DropboxIgnorer) Unignore(paths []string) ([]UnignoredPath, error) {
+	r := unignoreRequest{
+		paths:  paths,
+		result: make(chan unignoreResult, 1),
+	}
+	select {
+	case <-i.ctx.Done():
+		return nil, i.ctx.Err()
+	case i.unignoreRequests <- r:
+	}
+	select {
+	case <-i.ctx.Done():
+		return nil, i.ctx.Err()
+	case result := <-r.result:
+		return result.paths, result.err
+	}
+}
+
+func (i *DropboxIgnorer) handleUnignoreRequest(r unignoreRequest) {
+	results := []UnignoredPath{}
+	for _, path := range r.paths {
+		if !isInsideRoots([]string{i.dropboxPath}, path) {
+			r.result <- unignoreResult{err: fmt.Errorf("%s is not inside the dropbox folder %s", path, i.dropboxPath)}
+			return
+		}
+		i.removeIgnoredPath(path, CauseUnignoreRequest)
+		hasFlag, err := HasDropboxIgnoreFlag(path)
+		if err != nil {
+			r.result <- unignoreResult{err: fmt.Errorf("error checking ignore flag of %s: %w", path, err)}
+			return
+		}
+		if hasFlag {
+			err = RemoveDropboxIgnoreFlag(path)
+			if err != nil {
+				r.result <- unignoreResult{err: fmt.Errorf("error removing ignore flag of %s: %w", path, err)}
+				return
+			}
+			i.logger.Info("unignored path", LogKeyPath, path)
+		}
+		results = append(results, UnignoredPath{Path: path, Unignored: hasFlag})
+	}
+	r.result <- unignoreResult{paths: results}
+}